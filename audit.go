@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// auditConditionType returns the condition type a gate sets when it only
+// reports changes, e.g. "ApprovalWouldBeRequired" for "ApprovalRequired"
+func auditConditionType(g *v1beta1.Gate) string {
+	if base, ok := strings.CutSuffix(*g.ConditionType, "ApprovalRequired"); ok {
+		return base + "ApprovalWouldBeRequired"
+	}
+	return *g.ConditionType + "WouldBeRequired"
+}
+
+// auditCount returns how many changes would have required approval so far
+func (f *Function) auditCount(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse) (int64, error) {
+	xrStatus, _, err := f.getXRAndStatus(req)
+	if err != nil {
+		response.Fatal(rsp, err)
+		return 0, err
+	}
+
+	// Resolve the field relative to status
+	statusField := trimStatusPrefix(*g.AuditField + ".count")
+
+	value, _, err := GetNestedValue(xrStatus, statusField)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrapf(err, "error accessing status field %s", statusField))
+		return 0, err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	}
+	return 0, nil
+}
+
+// recordAudit records a change that would have required approval, and returns
+// how many changes would have so far. A change is only counted once, however
+// often the XR is reconciled while it's pending.
+func (f *Function) recordAudit(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse, state *approvalState, reason string) (int64, error) {
+	recorded, _, err := f.getStatusString(req, *g.AuditField+".hash", rsp)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := f.auditCount(req, g, rsp)
+	if err != nil {
+		return 0, err
+	}
+	if recorded == "" || !sameHash(recorded, state.NewHash) {
+		count++
+	}
+
+	err = f.setStatusFields(rsp, map[string]interface{}{
+		*g.AuditField + ".hash":   state.NewHash,
+		*g.AuditField + ".reason": reason,
+		*g.AuditField + ".count":  count,
+		*g.AuditField + ".source": gateApprovalSource(g),
+	})
+	return count, err
+}
+
+// clearAudit records that no change would require approval any more. The
+// count is kept, and the source an approval was read from is recorded.
+func (f *Function) clearAudit(g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse) error {
+	return f.setStatusFields(rsp, map[string]interface{}{
+		*g.AuditField + ".hash":   "",
+		*g.AuditField + ".reason": "",
+		*g.AuditField + ".source": gateApprovalSource(g),
+	})
+}
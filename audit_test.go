@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+)
+
+func TestAuditConditionType(t *testing.T) {
+	cases := map[string]struct {
+		conditionType string
+		want          string
+	}{
+		"Default": {
+			conditionType: "ApprovalRequired",
+			want:          "ApprovalWouldBeRequired",
+		},
+		"NamedGate": {
+			conditionType: "CostLimitsApprovalRequired",
+			want:          "CostLimitsApprovalWouldBeRequired",
+		},
+		"Custom": {
+			conditionType: "DatabaseReview",
+			want:          "DatabaseReviewWouldBeRequired",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			g := &v1beta1.Gate{ConditionType: &tc.conditionType}
+			if got := auditConditionType(g); got != tc.want {
+				t.Errorf("auditConditionType(...): want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"github.com/google/cel-go/cel"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// autoApproveRule is a compiled auto-approval rule
+type autoApproveRule struct {
+	// Name identifies the rule
+	Name string
+
+	// Program evaluates the rule's expression
+	Program cel.Program
+}
+
+// compileRules compiles auto-approval rules. Every rule must return a bool.
+func compileRules(rules []v1beta1.AutoApproveRule) ([]autoApproveRule, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("old", cel.DynType),
+		cel.Variable("new", cel.DynType),
+		cel.Variable("observed", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("diff", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create CEL environment")
+	}
+
+	compiled := make([]autoApproveRule, 0, len(rules))
+	for _, r := range rules {
+		name := r.Name
+		if name == "" {
+			name = r.Expression
+		}
+
+		ast, iss := env.Compile(r.Expression)
+		if iss.Err() != nil {
+			return nil, errors.Wrapf(iss.Err(), "cannot compile auto-approval rule %s", name)
+		}
+		if t := ast.OutputType(); t != cel.BoolType && t != cel.DynType {
+			return nil, errors.Errorf("auto-approval rule %s returns %s, not bool", name, t)
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot compile auto-approval rule %s", name)
+		}
+		compiled = append(compiled, autoApproveRule{Name: name, Program: prg})
+	}
+	return compiled, nil
+}
+
+// evaluateRules returns the name of the first rule that approves the change,
+// and the errors of rules that couldn't be evaluated. A rule that fails to
+// evaluate doesn't approve the change.
+func evaluateRules(rules []autoApproveRule, vars map[string]interface{}) (string, []error) {
+	var errs []error
+	for _, r := range rules {
+		out, _, err := r.Program.Eval(vars)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "auto-approval rule %s", r.Name))
+			continue
+		}
+
+		approved, ok := out.Value().(bool)
+		if !ok {
+			errs = append(errs, errors.Errorf("auto-approval rule %s returned %v, not a bool", r.Name, out.Value()))
+			continue
+		}
+		if approved {
+			return r.Name, errs
+		}
+	}
+	return "", errs
+}
+
+// ruleVars returns the variables auto-approval rules are evaluated with
+func ruleVars(approved, pending *snapshot, fields []watchedField, changes []change, observed map[string]interface{}) map[string]interface{} {
+	diff := make(map[string]interface{})
+	for _, c := range changes {
+		entry := map[string]interface{}{"path": c.Path, "class": c.Class, "old": c.Old, "new": c.New}
+		list, _ := diff[c.Kind].([]interface{})
+		diff[c.Kind] = append(list, entry)
+	}
+
+	// CEL doesn't mix integers and doubles in arithmetic, so whole numbers
+	// are passed as integers to let rules like "old.replicas * 2" work
+	n := &v1beta1.Normalization{NormalizeNumbers: true}
+	return map[string]interface{}{
+		"old":      normalizeValue(ruleData(approved, fields), n),
+		"new":      normalizeValue(ruleData(pending, fields), n),
+		"observed": normalizeValue(observed, n),
+		"diff":     normalizeValue(diff, n),
+	}
+}
+
+// ruleData returns the data in a snapshot as rules see it: the value of the
+// watched field if a single field without wildcards is watched, and otherwise
+// the values keyed by path
+func ruleData(s *snapshot, fields []watchedField) interface{} {
+	if len(fields) == 1 && !fields[0].Pattern {
+		return s.Fields[fields[0].Path]
+	}
+	return s.Fields
+}
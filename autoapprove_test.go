@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+)
+
+func TestCompileRules(t *testing.T) {
+	cases := map[string]struct {
+		rules   []v1beta1.AutoApproveRule
+		wantErr bool
+	}{
+		"Valid": {
+			rules: []v1beta1.AutoApproveRule{{Expression: "new.replicas <= old.replicas * 2"}},
+		},
+		"SyntaxError": {
+			rules:   []v1beta1.AutoApproveRule{{Expression: "new.replicas <="}},
+			wantErr: true,
+		},
+		"NotBool": {
+			rules:   []v1beta1.AutoApproveRule{{Name: "count", Expression: "size(diff)"}},
+			wantErr: true,
+		},
+		"UnknownVariable": {
+			rules:   []v1beta1.AutoApproveRule{{Expression: "desired.replicas == 1"}},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := compileRules(tc.rules)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("compileRules(...): want error %t, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestEvaluateRules(t *testing.T) {
+	approved := &snapshot{Fields: map[string]interface{}{
+		"spec.resources": map[string]interface{}{"replicas": float64(3), "zones": []interface{}{"a", "b"}},
+	}}
+	fields := []watchedField{{Path: "spec.resources"}}
+	observed := map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{"env": "dev"}}}
+
+	cases := map[string]struct {
+		pending map[string]interface{}
+		changes []change
+		rules   []v1beta1.AutoApproveRule
+		want    string
+		errs    int
+	}{
+		"ScaleWithinLimit": {
+			pending: map[string]interface{}{"replicas": float64(5), "zones": []interface{}{"a", "b"}},
+			changes: []change{{Path: "spec.resources.replicas", Kind: changeModified, Old: float64(3), New: float64(5)}},
+			rules: []v1beta1.AutoApproveRule{
+				{Name: "no-removals", Expression: "has(diff.removed)"},
+				{Name: "scale", Expression: "new.replicas <= old.replicas * 2"},
+			},
+			want: "scale",
+		},
+		"ScaleBeyondLimit": {
+			pending: map[string]interface{}{"replicas": float64(7), "zones": []interface{}{"a", "b"}},
+			changes: []change{{Path: "spec.resources.replicas", Kind: changeModified, Old: float64(3), New: float64(7)}},
+			rules:   []v1beta1.AutoApproveRule{{Name: "scale", Expression: "new.replicas <= old.replicas * 2"}},
+		},
+		"NoRemovals": {
+			pending: map[string]interface{}{"replicas": float64(3), "zones": []interface{}{"a", "b", "c"}},
+			changes: []change{{Path: "spec.resources.zones[2]", Kind: changeAdded, New: "c"}},
+			rules:   []v1beta1.AutoApproveRule{{Expression: "!has(diff.removed)"}},
+			want:    "!has(diff.removed)",
+		},
+		"Observed": {
+			pending: map[string]interface{}{"replicas": float64(1), "zones": []interface{}{"a"}},
+			changes: []change{{Path: "spec.resources.zones[1]", Kind: changeRemoved, Old: "b"}},
+			rules:   []v1beta1.AutoApproveRule{{Name: "dev", Expression: `observed.metadata.labels.env == "dev"`}},
+			want:    "dev",
+		},
+		"EvaluationError": {
+			pending: map[string]interface{}{"zones": []interface{}{"a", "b"}},
+			changes: []change{{Path: "spec.resources.replicas", Kind: changeRemoved, Old: float64(3)}},
+			rules:   []v1beta1.AutoApproveRule{{Name: "scale", Expression: "new.replicas <= old.replicas * 2"}},
+			errs:    1,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rules, err := compileRules(tc.rules)
+			if err != nil {
+				t.Fatalf("compileRules(...): unexpected error: %v", err)
+			}
+
+			pending := &snapshot{Fields: map[string]interface{}{"spec.resources": tc.pending}}
+			got, errs := evaluateRules(rules, ruleVars(approved, pending, fields, tc.changes, observed))
+			if got != tc.want {
+				t.Errorf("evaluateRules(...): want rule %q, got %q", tc.want, got)
+			}
+			if len(errs) != tc.errs {
+				t.Errorf("evaluateRules(...): want %d errors, got %v", tc.errs, errs)
+			}
+		})
+	}
+}
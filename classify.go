@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+)
+
+// classifyChanges sets the class of every change: additions are additive,
+// removals and decreases are destructive, and any other change is modifying.
+func classifyChanges(changes []change) {
+	for i := range changes {
+		c := &changes[i]
+		switch c.Kind {
+		case changeAdded:
+			c.Class = v1beta1.ChangeClassAdditive
+		case changeRemoved:
+			c.Class = v1beta1.ChangeClassDestructive
+		default:
+			c.Class = v1beta1.ChangeClassModifying
+			if cmp, ok := compareQuantities(c.Old, c.New); ok && cmp > 0 {
+				c.Class = v1beta1.ChangeClassDestructive
+			}
+		}
+	}
+}
+
+// changeClasses returns the distinct classes of the changes, sorted
+func changeClasses(changes []change) []string {
+	seen := make(map[string]bool)
+	var classes []string
+	for _, c := range changes {
+		if !seen[c.Class] {
+			seen[c.Class] = true
+			classes = append(classes, c.Class)
+		}
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// requiredClasses returns the classes of the changes that require approval.
+// Changes within a tolerance never require approval.
+func requiredClasses(changes []change, g *v1beta1.Gate) []string {
+	required := make(map[string]bool, len(g.RequireApprovalFor))
+	for _, class := range g.RequireApprovalFor {
+		required[class] = true
+	}
+
+	var classes []string
+	for _, class := range changeClasses(untoleratedChanges(changes)) {
+		if required[class] {
+			classes = append(classes, class)
+		}
+	}
+	return classes
+}
+
+// untoleratedChanges returns the changes that aren't within a tolerance
+func untoleratedChanges(changes []change) []change {
+	var untolerated []change
+	for _, c := range changes {
+		if !c.Tolerated {
+			untolerated = append(untolerated, c)
+		}
+	}
+	return untolerated
+}
+
+// autoApprovalReason explains why changes that don't require approval went
+// through on their own
+func autoApprovalReason(changes []change) string {
+	untolerated := untoleratedChanges(changes)
+
+	switch {
+	case len(untolerated) == 0:
+		return "All changes are within tolerances"
+	case len(untolerated) < len(changes):
+		return "No changes of a class that requires approval (" + strings.ToLower(strings.Join(changeClasses(untolerated), ", ")) + "), and the other changes are within tolerances"
+	default:
+		return "No changes of a class that requires approval (" + strings.ToLower(strings.Join(changeClasses(untolerated), ", ")) + ")"
+	}
+}
+
+// compareQuantities compares two numbers or Kubernetes quantities, such as
+// "100Gi" or "500m". It returns -1, 0 or 1 as old is less than, equal to or
+// greater than new, and false if either isn't a number or a quantity.
+func compareQuantities(old, now interface{}) (int, bool) {
+	o, ok := toQuantity(old)
+	if !ok {
+		return 0, false
+	}
+	n, ok := toQuantity(now)
+	if !ok {
+		return 0, false
+	}
+	return o.Cmp(n), true
+}
+
+// toQuantity converts a number or a quantity string to a quantity
+func toQuantity(v interface{}) (resource.Quantity, bool) {
+	var s string
+	switch t := v.(type) {
+	case string:
+		s = strings.TrimSpace(t)
+	case float64, int64, int, json.Number:
+		data, err := json.Marshal(t)
+		if err != nil {
+			return resource.Quantity{}, false
+		}
+		s = string(data)
+	default:
+		return resource.Quantity{}, false
+	}
+
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return resource.Quantity{}, false
+	}
+	return q, true
+}
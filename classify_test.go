@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+)
+
+func TestClassifyChanges(t *testing.T) {
+	changes := []change{
+		{Path: "spec.tags.team", Kind: changeAdded, New: "db"},
+		{Path: "spec.zones[1]", Kind: changeRemoved, Old: "b"},
+		{Path: "spec.size", Kind: changeModified, Old: "large", New: "small"},
+		{Path: "spec.storage", Kind: changeModified, Old: "100Gi", New: "1Ti"},
+		{Path: "spec.storage", Kind: changeModified, Old: "1Gi", New: "500Mi"},
+		{Path: "spec.replicas", Kind: changeModified, Old: float64(3), New: float64(1)},
+		{Path: "spec.cpu", Kind: changeModified, Old: "500m", New: float64(1)},
+	}
+	classifyChanges(changes)
+
+	want := []string{
+		v1beta1.ChangeClassAdditive,
+		v1beta1.ChangeClassDestructive,
+		v1beta1.ChangeClassModifying,
+		v1beta1.ChangeClassModifying,
+		v1beta1.ChangeClassDestructive,
+		v1beta1.ChangeClassDestructive,
+		v1beta1.ChangeClassModifying,
+	}
+	for i, c := range changes {
+		if c.Class != want[i] {
+			t.Errorf("classifyChanges(...): %s from %v to %v: want %s, got %s", c.Path, c.Old, c.New, want[i], c.Class)
+		}
+	}
+}
+
+func TestRequiredClasses(t *testing.T) {
+	changes := []change{
+		{Class: v1beta1.ChangeClassModifying},
+		{Class: v1beta1.ChangeClassAdditive},
+		{Class: v1beta1.ChangeClassModifying},
+	}
+	g := &v1beta1.Gate{GateSpec: v1beta1.GateSpec{
+		RequireApprovalFor: []string{v1beta1.ChangeClassModifying, v1beta1.ChangeClassDestructive},
+	}}
+
+	got := requiredClasses(changes, g)
+	want := []string{v1beta1.ChangeClassModifying}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("requiredClasses(...): want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+// desiredResourcesPath is the path desired composed resources are watched at.
+// Each resource is watched at desiredResources.<name>.
+const desiredResourcesPath = "desiredResources"
+
+// desiredResourcePath returns the path a desired composed resource is watched
+// at, optionally followed by a path within the resource
+func desiredResourcePath(name string, within ...PathSegment) string {
+	segments := []PathSegment{
+		{Type: PathSegmentField, Field: desiredResourcesPath},
+		{Type: PathSegmentField, Field: name},
+	}
+	return FormatPath(append(segments, within...))
+}
+
+// selectDesiredResources returns the desired composed resources selected by
+// the supplied filters, keyed by their name in the pipeline
+func selectDesiredResources(req *fnv1.RunFunctionRequest, sel *v1beta1.DesiredResources) (map[string]map[string]interface{}, error) {
+	selector := labels.Everything()
+	if sel.Selector != nil {
+		var err error
+		selector, err = metav1.LabelSelectorAsSelector(sel.Selector)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid desired resources selector")
+		}
+	}
+
+	names := make(map[string]bool, len(sel.Names))
+	for _, name := range sel.Names {
+		names[name] = true
+	}
+
+	selected := make(map[string]map[string]interface{})
+	for name, r := range req.GetDesired().GetResources() {
+		obj := r.GetResource().AsMap()
+		if len(names) > 0 && !names[name] {
+			continue
+		}
+		if sel.APIVersion != "" && obj["apiVersion"] != sel.APIVersion {
+			continue
+		}
+		if sel.Kind != "" && obj["kind"] != sel.Kind {
+			continue
+		}
+		if !selector.Matches(labels.Set(resourceLabels(obj))) {
+			continue
+		}
+		selected[name] = obj
+	}
+	return selected, nil
+}
+
+// resourceLabels returns the labels of a resource
+func resourceLabels(obj map[string]interface{}) map[string]string {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	raw, _ := metadata["labels"].(map[string]interface{})
+
+	out := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			out[k] = s
+		}
+	}
+	return out
+}
+
+// extractDesiredResources returns the selected desired composed resources as a
+// single watched field, and the fields that were ignored. Ignored paths are
+// stripped and the gate's normalization is applied, but set paths are relative
+// to the XR so they don't apply. Every resource is a match of the field, so
+// each one gets its own field hash.
+func (f *Function) extractDesiredResources(req *fnv1.RunFunctionRequest, g *v1beta1.Gate) (watchedField, []PathMatch, error) {
+	resources, err := selectDesiredResources(req, g.DesiredResources)
+	if err != nil {
+		return watchedField{}, nil, err
+	}
+
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	field := watchedField{Path: desiredResourcesPath, Pattern: true}
+	values := make([]interface{}, 0, len(names))
+	var ignored []PathMatch
+	for _, name := range names {
+		obj := resources[name]
+		stripped, err := stripIgnoredPaths(obj, g.DesiredResources.IgnorePaths)
+		if err != nil {
+			return watchedField{}, nil, errors.Wrapf(err, "cannot strip ignored paths from desired resource %s", name)
+		}
+		for _, m := range stripped {
+			segments, err := ParseNestedKey(m.Path)
+			if err != nil {
+				return watchedField{}, nil, err
+			}
+			ignored = append(ignored, PathMatch{Path: desiredResourcePath(name, segments...), Value: m.Value})
+		}
+
+		m := PathMatch{Path: desiredResourcePath(name), Value: normalizeValue(obj, g.Normalization)}
+		field.Matches = append(field.Matches, m)
+		values = append(values, map[string]interface{}{"path": m.Path, "value": m.Value})
+	}
+	field.Value = values
+
+	return field, ignored, nil
+}
+
+// withDesiredResources returns a shallow copy of the XR with the watched
+// desired composed resources under desiredResources, so paths can select
+// values in them
+func withDesiredResources(xr map[string]interface{}, fields []watchedField) map[string]interface{} {
+	data := make(map[string]interface{}, len(xr)+1)
+	for k, v := range xr {
+		data[k] = v
+	}
+
+	resources := make(map[string]interface{})
+	for _, field := range fields {
+		if field.Path != desiredResourcesPath || !field.Pattern {
+			continue
+		}
+		for _, m := range field.Matches {
+			segments, err := ParseNestedKey(m.Path)
+			if err != nil {
+				continue
+			}
+			resources[segments[len(segments)-1].Field] = m.Value
+		}
+	}
+	data[desiredResourcesPath] = resources
+	return data
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestSelectDesiredResources(t *testing.T) {
+	req := &fnv1.RunFunctionRequest{
+		Desired: &fnv1.State{
+			Resources: map[string]*fnv1.Resource{
+				"db": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "rds.aws.upbound.io/v1beta1",
+					"kind": "Instance",
+					"metadata": {"labels": {"tier": "data"}}
+				}`)},
+				"cache": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "elasticache.aws.upbound.io/v1beta1",
+					"kind": "Cluster",
+					"metadata": {"labels": {"tier": "data"}}
+				}`)},
+				"bucket": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "s3.aws.upbound.io/v1beta1",
+					"kind": "Bucket"
+				}`)},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		sel  *v1beta1.DesiredResources
+		want []string
+	}{
+		"All": {
+			sel:  &v1beta1.DesiredResources{},
+			want: []string{"bucket", "cache", "db"},
+		},
+		"Names": {
+			sel:  &v1beta1.DesiredResources{Names: []string{"db", "missing"}},
+			want: []string{"db"},
+		},
+		"Kind": {
+			sel:  &v1beta1.DesiredResources{APIVersion: "s3.aws.upbound.io/v1beta1", Kind: "Bucket"},
+			want: []string{"bucket"},
+		},
+		"Selector": {
+			sel:  &v1beta1.DesiredResources{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "data"}}},
+			want: []string{"cache", "db"},
+		},
+		"AllFiltersMustMatch": {
+			sel:  &v1beta1.DesiredResources{Names: []string{"db", "bucket"}, Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "data"}}},
+			want: []string{"db"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			selected, err := selectDesiredResources(req, tc.sel)
+			if err != nil {
+				t.Fatalf("selectDesiredResources(...): unexpected error: %v", err)
+			}
+
+			got := make([]string, 0, len(selected))
+			for name := range selected {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("selectDesiredResources(...): want %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("selectDesiredResources(...): want %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
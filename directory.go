@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// approverDirectory maps each approver's name to the groups they are members
+// of
+type approverDirectory map[string][]string
+
+// approverDirectoryKey returns the key the gate's approver directory is
+// required under
+func approverDirectoryKey(g *v1beta1.Gate) string {
+	if g.Name != "" {
+		return "approver-directory-" + g.Name
+	}
+	return "approver-directory"
+}
+
+// approverDirectorySelector returns the selector of the object holding the
+// approver directory
+func approverDirectorySelector(d *v1beta1.ApproverDirectory) *fnv1.ResourceSelector {
+	kind := d.Kind
+	if kind == "" {
+		kind = v1beta1.ApproverDirectoryConfigMap
+	}
+
+	apiVersion := d.APIVersion
+	if apiVersion == "" {
+		apiVersion = "v1"
+		if kind == v1beta1.ApproverDirectoryEnvironmentConfig {
+			apiVersion = "apiextensions.crossplane.io/v1beta1"
+		}
+	}
+
+	sel := &fnv1.ResourceSelector{
+		ApiVersion: apiVersion,
+		Kind:       kind,
+		Match:      &fnv1.ResourceSelector_MatchName{MatchName: d.Name},
+	}
+	if d.Namespace != "" {
+		sel.Namespace = &d.Namespace
+	}
+	return sel
+}
+
+// parseApproverDirectory reads the approvers and their groups from the data
+// of the supplied objects. Groups are a list, or a comma separated string.
+func parseApproverDirectory(objs []*unstructured.Unstructured) approverDirectory {
+	dir := make(approverDirectory)
+	for _, obj := range objs {
+		data, _ := obj.Object["data"].(map[string]interface{})
+		for name, v := range data {
+			var groups []string
+			switch v := v.(type) {
+			case string:
+				for _, group := range strings.Split(v, ",") {
+					if group = strings.TrimSpace(group); group != "" {
+						groups = append(groups, group)
+					}
+				}
+			case []interface{}:
+				for _, group := range v {
+					if s, ok := group.(string); ok && s != "" {
+						groups = append(groups, s)
+					}
+				}
+			}
+			dir[name] = append(dir[name], groups...)
+		}
+	}
+	return dir
+}
+
+// verifyApprovers returns the approver records whose approver is listed in
+// the directory, and a reason for each record that was rejected. An approver
+// can only approve for a group they are a member of.
+func verifyApprovers(records []approverRecord, dir approverDirectory) ([]approverRecord, []string) {
+	var verified []approverRecord
+	var rejected []string
+	for _, r := range records {
+		groups, listed := dir[r.Name]
+		switch {
+		case !listed:
+			rejected = append(rejected, fmt.Sprintf("%s is not listed in the approver directory", r.Name))
+		case r.Group != "" && !slices.Contains(groups, r.Group):
+			rejected = append(rejected, fmt.Sprintf("%s is not a member of group %s", r.Name, r.Group))
+		default:
+			verified = append(verified, r)
+		}
+	}
+	return verified, rejected
+}
+
+// getApproverDirectory requires the gate's approver directory, and returns it
+// once Crossplane has fetched it. It returns nil until then. A directory that
+// doesn't exist lists no approvers.
+func (f *Function) getApproverDirectory(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse) (approverDirectory, error) {
+	key := approverDirectoryKey(g)
+	sel := approverDirectorySelector(g.ApproverDirectory)
+
+	// The requirement must be repeated on every call, or Crossplane stops
+	// fetching the directory
+	requireResources(rsp, key, sel)
+
+	objs, resolved, err := requiredResources(req, key)
+	if err != nil {
+		response.Fatal(rsp, err)
+		return nil, err
+	}
+	if !resolved {
+		f.log.Debug("Waiting for the approver directory", "gate", g.Name)
+		return nil, nil
+	}
+	if len(objs) == 0 {
+		response.Warning(rsp, errors.Errorf("approver directory %s %s not found", sel.GetKind(), g.ApproverDirectory.Name)).
+			TargetComposite()
+	}
+
+	return parseApproverDirectory(objs), nil
+}
+
+// validateApproverDirectory checks that the directory names its object
+func validateApproverDirectory(d *v1beta1.ApproverDirectory) error {
+	if d.Name == "" {
+		return errors.New("approverDirectory must set a name")
+	}
+	switch d.Kind {
+	case "", v1beta1.ApproverDirectoryConfigMap:
+		if d.Namespace == "" {
+			return errors.New("approverDirectory must set a namespace for a ConfigMap")
+		}
+	case v1beta1.ApproverDirectoryEnvironmentConfig:
+	default:
+		return errors.Errorf("unknown approverDirectory kind %q", d.Kind)
+	}
+	return nil
+}
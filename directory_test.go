@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+func TestApproverDirectorySelector(t *testing.T) {
+	namespace := "crossplane-system"
+
+	cases := map[string]struct {
+		dir  v1beta1.ApproverDirectory
+		want *fnv1.ResourceSelector
+	}{
+		"ConfigMap": {
+			dir: v1beta1.ApproverDirectory{Name: "approvers", Namespace: namespace},
+			want: &fnv1.ResourceSelector{
+				ApiVersion: "v1",
+				Kind:       "ConfigMap",
+				Match:      &fnv1.ResourceSelector_MatchName{MatchName: "approvers"},
+				Namespace:  &namespace,
+			},
+		},
+		"EnvironmentConfig": {
+			dir: v1beta1.ApproverDirectory{Kind: "EnvironmentConfig", Name: "approvers"},
+			want: &fnv1.ResourceSelector{
+				ApiVersion: "apiextensions.crossplane.io/v1beta1",
+				Kind:       "EnvironmentConfig",
+				Match:      &fnv1.ResourceSelector_MatchName{MatchName: "approvers"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := approverDirectorySelector(&tc.dir)
+			if got.GetApiVersion() != tc.want.GetApiVersion() || got.GetKind() != tc.want.GetKind() ||
+				got.GetMatchName() != tc.want.GetMatchName() || got.GetNamespace() != tc.want.GetNamespace() {
+				t.Errorf("approverDirectorySelector(...): want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseApproverDirectory(t *testing.T) {
+	objs := []*unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"kind": "ConfigMap",
+			"data": map[string]interface{}{
+				"alice": "security, platform",
+				"bob":   "",
+			},
+		}},
+		{Object: map[string]interface{}{
+			"kind": "EnvironmentConfig",
+			"data": map[string]interface{}{
+				"carol": []interface{}{"dev", "security"},
+			},
+		}},
+	}
+
+	want := approverDirectory{
+		"alice": {"security", "platform"},
+		"bob":   nil,
+		"carol": {"dev", "security"},
+	}
+	if got := parseApproverDirectory(objs); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseApproverDirectory(...): want %v, got %v", want, got)
+	}
+}
+
+func TestVerifyApprovers(t *testing.T) {
+	dir := approverDirectory{
+		"alice": {"security"},
+		"bob":   {"dev"},
+	}
+	records := []approverRecord{
+		{Name: "alice", Group: "security", Hash: "a"},
+		{Name: "bob", Hash: "a"},
+		{Name: "bob", Group: "security", Hash: "a"},
+		{Name: "mallory", Group: "security", Hash: "a"},
+	}
+
+	wantVerified := []approverRecord{
+		{Name: "alice", Group: "security", Hash: "a"},
+		{Name: "bob", Hash: "a"},
+	}
+	wantRejected := []string{
+		"bob is not a member of group security",
+		"mallory is not listed in the approver directory",
+	}
+
+	verified, rejected := verifyApprovers(records, dir)
+	if !reflect.DeepEqual(verified, wantVerified) {
+		t.Errorf("verifyApprovers(...): want verified %v, got %v", wantVerified, verified)
+	}
+	if !reflect.DeepEqual(rejected, wantRejected) {
+		t.Errorf("verifyApprovers(...): want rejected %v, got %v", wantRejected, rejected)
+	}
+}
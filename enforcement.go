@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// enforcementAnnotation selects the enforcement mode of every gate evaluated
+// for an XR, if the gates allow the mode as an override
+const enforcementAnnotation = "approve.fn.crossplane.io/enforcement"
+
+// enforcementModes are the supported enforcement modes
+var enforcementModes = []string{
+	v1beta1.EnforcementFatal,
+	v1beta1.EnforcementHold,
+	v1beta1.EnforcementHoldChanged,
+	v1beta1.EnforcementPause,
+	v1beta1.EnforcementWarning,
+}
+
+// gateEnforcementAnnotation returns the annotation that selects the
+// enforcement mode of a single named gate, e.g.
+// "cost-limits.approve.fn.crossplane.io/enforcement"
+func gateEnforcementAnnotation(name string) string {
+	return name + "." + enforcementAnnotation
+}
+
+// selectedEnforcement returns the enforcement mode the XR's annotations select
+// for a gate, and the annotation that selected it. A gate's own annotation
+// takes precedence over the one for every gate.
+func selectedEnforcement(annotations map[string]string, g *v1beta1.Gate) (string, string) {
+	if g.Name != "" {
+		key := gateEnforcementAnnotation(g.Name)
+		if mode, ok := annotations[key]; ok {
+			return mode, key
+		}
+	}
+	if mode, ok := annotations[enforcementAnnotation]; ok {
+		return mode, enforcementAnnotation
+	}
+	return "", ""
+}
+
+// overrideEnforcement applies the enforcement mode selected by the XR's
+// annotations to the gate. Only modes the input allows as overrides are
+// applied, so that platform admins decide what an XR can relax. Anything else
+// is ignored with a warning rather than failing the XR.
+func (f *Function) overrideEnforcement(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse) error {
+	oxr, err := request.GetObservedCompositeResource(req)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot get observed composite resource"))
+		return err
+	}
+
+	mode, key := selectedEnforcement(oxr.Resource.GetAnnotations(), g)
+	if mode == "" || mode == *g.Enforcement {
+		return nil
+	}
+
+	if !slices.Contains(g.EnforcementOverrides, mode) {
+		response.Warning(rsp, errors.Errorf("ignoring annotation %s: enforcement %q is not an allowed override", key, mode)).
+			TargetCompositeAndClaim()
+		return nil
+	}
+
+	f.log.Info("Overriding enforcement", "gate", g.Name, "from", *g.Enforcement, "to", mode, "annotation", key)
+	response.Normalf(rsp, "Enforcement is %s, as selected by annotation %s", mode, key).
+		TargetComposite()
+	g.Enforcement = &mode
+	return nil
+}
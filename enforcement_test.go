@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+)
+
+func TestSelectedEnforcement(t *testing.T) {
+	cases := map[string]struct {
+		annotations map[string]string
+		gate        string
+		wantMode    string
+		wantKey     string
+	}{
+		"NoAnnotation": {
+			annotations: map[string]string{"example.org/team": "data"},
+		},
+		"EveryGate": {
+			annotations: map[string]string{enforcementAnnotation: "Warning"},
+			gate:        "cost-limits",
+			wantMode:    "Warning",
+			wantKey:     enforcementAnnotation,
+		},
+		"GateTakesPrecedence": {
+			annotations: map[string]string{
+				enforcementAnnotation:                  "Warning",
+				"cost-limits." + enforcementAnnotation: "Hold",
+			},
+			gate:     "cost-limits",
+			wantMode: "Hold",
+			wantKey:  "cost-limits." + enforcementAnnotation,
+		},
+		"OtherGate": {
+			annotations: map[string]string{"security." + enforcementAnnotation: "Warning"},
+			gate:        "cost-limits",
+		},
+		"UnnamedGate": {
+			annotations: map[string]string{enforcementAnnotation: "Pause"},
+			wantMode:    "Pause",
+			wantKey:     enforcementAnnotation,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			mode, key := selectedEnforcement(tc.annotations, &v1beta1.Gate{Name: tc.gate})
+			if mode != tc.wantMode || key != tc.wantKey {
+				t.Errorf("selectedEnforcement(...): want %q from %q, got %q from %q", tc.wantMode, tc.wantKey, mode, key)
+			}
+		})
+	}
+}
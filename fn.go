@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/upbound/function-approve/input/v1beta1"
 
@@ -15,6 +19,7 @@ import (
 	"github.com/crossplane/function-sdk-go/request"
 	"github.com/crossplane/function-sdk-go/resource"
 	"github.com/crossplane/function-sdk-go/response"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // Function implements the manual approval workflow function.
@@ -36,24 +41,79 @@ func (f *Function) RunFunction(_ context.Context, req *fnv1.RunFunctionRequest)
 		return rsp, nil //nolint:nilerr // errors are handled in rsp
 	}
 
-	// Process hashing logic and get approval status
-	newHash, currentHash, approved, err := f.processHashingAndApproval(req, in, rsp)
+	// Resolve the approval gates to evaluate
+	gates, err := f.resolveGates(in, rsp)
 	if err != nil {
 		return rsp, nil //nolint:nilerr // errors are handled in rsp
 	}
 
-	// Check if changes need approval
-	if f.needsApproval(approved, currentHash, newHash) {
-		f.handleUnapprovedChanges(req, in, rsp, currentHash, newHash)
+	// Evaluate every gate, so each one reports its own condition
+	var blocked, held, reported []string
+	pauses := pauseDecisions{}
+	for i := range gates {
+		g := &gates[i]
+
+		// The XR may select another enforcement mode, if the input allows it
+		if err := f.overrideEnforcement(req, g, rsp); err != nil {
+			return rsp, nil //nolint:nilerr // errors are handled in rsp
+		}
+
+		// Process hashing logic and get approval status
+		state, err := f.processHashingAndApproval(req, g, rsp)
+		if err != nil {
+			return rsp, nil //nolint:nilerr // errors are handled in rsp
+		}
+
+		// Check if changes need approval
+		if f.needsApproval(state) {
+			msg, err := f.handleUnapprovedChanges(req, g, rsp, state, pauses)
+			if err != nil {
+				return rsp, nil //nolint:nilerr // errors are handled in rsp
+			}
+			switch *g.Enforcement {
+			case v1beta1.EnforcementFatal:
+				blocked = append(blocked, msg)
+			case v1beta1.EnforcementWarning:
+				reported = append(reported, msg)
+			default:
+				held = append(held, msg)
+			}
+			continue
+		}
+
+		// Handle approved changes
+		err = f.handleApprovedChanges(req, g, rsp, state, pauses)
+		if err != nil {
+			return rsp, nil //nolint:nilerr // errors are handled in rsp
+		}
+	}
+
+	// Pause resources once every gate decided, so that a gate that was
+	// approved doesn't unpause resources another gate pauses
+	if err := pauses.apply(req, rsp); err != nil {
+		response.Fatal(rsp, err)
 		return rsp, nil
 	}
 
-	// Handle approved changes
-	err = f.handleApprovedChanges(req, in, rsp, newHash)
-	if err != nil {
-		return rsp, nil //nolint:nilerr // errors are handled in rsp
+	if len(blocked) > 0 {
+		// Use response.Fatal to halt the pipeline execution
+		// This stops the composition process entirely until approval is granted
+		f.log.Info("Halting pipeline until changes are approved", "gates", len(blocked))
+		response.Fatal(rsp, errors.New(strings.Join(blocked, "\n\n")))
+		return rsp, nil
 	}
 
+	// Set success condition
+	msg := "Approved successfully"
+	if len(held) > 0 {
+		msg = "Changes are held until they are approved"
+	} else if len(reported) > 0 {
+		msg = "Changes would require approval"
+	}
+	response.ConditionTrue(rsp, "FunctionSuccess", "Success").
+		WithMessage(msg).
+		TargetCompositeAndClaim()
+
 	return rsp, nil
 }
 
@@ -73,396 +133,1714 @@ func (f *Function) initializeFunction(req *fnv1.RunFunctionRequest, rsp *fnv1.Ru
 	return in, nil
 }
 
+// approvalState holds the hashes and approval decision computed for a run
+type approvalState struct {
+	// NewHash is the hash of the watched data as it is now
+	NewHash string
+
+	// CurrentHash is the previously approved hash
+	CurrentHash string
+
+	// Fields are the watched fields the hash was computed from
+	Fields []watchedField
+
+	// FieldHashes are the per-field hashes of the watched data, keyed by
+	// concrete path. They are only tracked when more than one field is
+	// watched, or when a path can match several fields.
+	FieldHashes map[string]string
+
+	// ApprovedFieldHashes are the per-field hashes recorded at the last approval
+	ApprovedFieldHashes map[string]string
+
+	// Ignored are the concrete fields within the watched data that were
+	// stripped before hashing, in order
+	Ignored []PathMatch
+
+	// IgnoredHashes are the per-field hashes of the ignored fields, keyed by
+	// concrete path. They are only tracked when ignore paths are configured.
+	IgnoredHashes map[string]string
+
+	// ApprovedIgnoredHashes are the hashes of the ignored fields recorded at
+	// the last approval
+	ApprovedIgnoredHashes map[string]string
+
+	// ApprovedSnapshot is the snapshot of the watched data taken at the last
+	// approval, if one is available
+	ApprovedSnapshot *snapshot
+
+	// Changes are the differences between the approved snapshot and the
+	// watched data. They are only known if there is an approved snapshot.
+	Changes []change
+
+	// HashKey is the key that seals the approved hash, if one is configured
+	HashKey []byte
+
+	// TamperedHash is the approved hash found on the XR if it wasn't sealed
+	// with the hash key. It is not trusted as an approval.
+	TamperedHash string
+
+	// Approval is the approval decision recorded on the XR
+	Approval approvalStatus
+
+	// AutoApproval explains why the change was approved without an approval,
+	// if it was
+	AutoApproval string
+
+	// RuleErrors are the errors of auto-approval rules that couldn't be
+	// evaluated
+	RuleErrors []error
+
+	// DesiredResources are the desired composed resources rendered by earlier
+	// steps, keyed by name. They are only tracked when resources are held
+	// back or paused.
+	DesiredResources map[string]interface{}
+
+	// ResourceHashes are the hashes of the desired state of each composed
+	// resource, keyed by name. They are only tracked when resources are held
+	// back or paused.
+	ResourceHashes map[string]string
+}
+
 // processHashingAndApproval handles hash computation and approval checks
-func (f *Function) processHashingAndApproval(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) (newHash, currentHash string, approved bool, err error) {
+func (f *Function) processHashingAndApproval(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse) (*approvalState, error) {
 	// Extract data to hash
-	dataToHash, err := f.extractDataToHash(req, in, rsp)
+	fields, ignored, err := f.extractDataToHash(req, g, rsp)
 	if err != nil {
-		return "", "", false, err
+		return nil, err
 	}
 
 	// Calculate hash
-	newHash = f.calculateHash(dataToHash, in)
+	state := &approvalState{
+		Fields:  fields,
+		Ignored: ignored,
+		NewHash: f.calculateHash(combineFields(fields), g),
+	}
+
+	if len(g.IgnorePaths) > 0 || (g.DesiredResources != nil && len(g.DesiredResources.IgnorePaths) > 0) {
+		state.IgnoredHashes = make(map[string]string, len(ignored))
+		for _, m := range ignored {
+			state.IgnoredHashes[m.Path] = f.calculateHash(m.Value, g)
+		}
+
+		state.ApprovedIgnoredHashes, err = f.getHashes(req, *g.IgnoredHashesField, rsp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(fields) > 1 || fields[0].Pattern {
+		state.FieldHashes = make(map[string]string)
+		for _, field := range fields {
+			for _, m := range field.matches() {
+				state.FieldHashes[m.Path] = f.calculateHash(m.Value, g)
+			}
+		}
+
+		state.ApprovedFieldHashes, err = f.getHashes(req, *g.FieldHashesField, rsp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tracksResources(g) {
+		state.DesiredResources = desiredResources(req)
+		state.ResourceHashes = f.resourceHashes(state.DesiredResources, g)
+	}
 
 	// Get current hash from status (the previously approved hash)
-	currentHash, err = f.getCurrentHash(req, in, rsp)
+	state.CurrentHash, err = f.getCurrentHash(req, g, rsp)
+	if err != nil {
+		return nil, err
+	}
+
+	// A sealed hash must have been sealed by us, or anyone able to write the
+	// status could approve a change by writing its hash
+	if g.HashKey != nil {
+		state.HashKey, err = f.getHashKey(req, g, rsp)
+		if err != nil {
+			return nil, err
+		}
+
+		if state.CurrentHash != "" {
+			unsealed, valid := verifySeal(state.CurrentHash, state.HashKey)
+			if !valid {
+				f.log.Info("Approved hash is not sealed with the hash key", "gate", g.Name, "hash", state.CurrentHash)
+				state.TamperedHash = state.CurrentHash
+				unsealed = ""
+			}
+			state.CurrentHash = unsealed
+		}
+	}
+
+	// A hash stored by another algorithm or encoding, or with other settings,
+	// is upgraded without approval if it still describes the watched data
+	if state.CurrentHash != "" && state.CurrentHash != state.NewHash {
+		recorded, err := f.getHashSettings(req, g, state, rsp)
+		if err != nil {
+			return nil, err
+		}
+		if f.isUpgradableHash(req, g, state, recorded) {
+			f.log.Info("Upgrading approved hash", "gate", g.Name, "from", state.CurrentHash, "to", state.NewHash)
+			state.CurrentHash = state.NewHash
+		}
+	}
+
+	// Get the snapshot of the approved data, to show what changed. It's read
+	// even if nothing changed, to keep its tolerance baseline.
+	if *g.MaxSnapshotSize > 0 && state.CurrentHash != "" {
+		state.ApprovedSnapshot, err = f.getApprovedSnapshot(req, g, state, rsp)
+		if err != nil {
+			return nil, err
+		}
+		if state.ApprovedSnapshot != nil && state.CurrentHash != state.NewHash {
+			state.Changes = diffSnapshots(state.ApprovedSnapshot, newSnapshot(state.NewHash, state.Fields))
+			classifyChanges(state.Changes)
+			if err := f.applyTolerances(req, g, state, rsp); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Check approval status against the hash we are waiting on
+	state.Approval, err = f.checkApprovalStatus(req, g, rsp, state.CurrentHash, state.NewHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Changes that don't include a class requiring approval go through on
+	// their own. A change is only let through if we know exactly what it is.
+	if !state.Approval.Approved && state.ApprovedSnapshot != nil && len(state.Changes) > 0 && len(requiredClasses(state.Changes, g)) == 0 {
+		state.AutoApproval = autoApprovalReason(state.Changes)
+	}
+
+	if !state.Approval.Approved && state.AutoApproval == "" && state.ApprovedSnapshot != nil && len(state.Changes) > 0 && len(g.AutoApprove) > 0 {
+		if err := f.evaluateAutoApproval(req, g, state, rsp); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// isUpgradableHash returns true if the approved hash is a digest of the watched
+// data, but wasn't produced the way the gate hashes it now. The data is checked
+// as it is hashed now, with the settings recorded at the last approval, and as
+// it was hashed before ignore paths and normalization were configured.
+func (f *Function) isUpgradableHash(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, state *approvalState, recorded *hashSettings) bool {
+	approved := parseHash(state.CurrentHash)
+	if approved.Version != hashVersion {
+		// We don't know how to reproduce this encoding
+		return false
+	}
+
+	settings := []hashSettings{{}}
+	if recorded != nil {
+		settings = append([]hashSettings{*recorded}, settings...)
+	}
+
+	candidates := []interface{}{combineFields(state.Fields)}
+	for _, s := range settings {
+		if data, err := f.extractDataWithSettings(req, g, s); err == nil {
+			candidates = append(candidates, data)
+		}
+	}
+
+	for _, data := range candidates {
+		if digest, err := digestData(approved.Algorithm, data); err == nil && digest == approved.Digest {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTolerances marks the changes that are within the gate's tolerances
+func (f *Function) applyTolerances(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, state *approvalState, rsp *fnv1.RunFunctionResponse) error {
+	if len(g.Tolerances) == 0 {
+		return nil
+	}
+
+	dxr, err := request.GetDesiredCompositeResource(req)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot get desired composite resource"))
+		return err
+	}
+
+	// Tolerance paths may select values in desired composed resources, which
+	// are watched under their own path
+	data := dxr.Resource.Object
+	if g.DesiredResources != nil {
+		data = withDesiredResources(data, state.Fields)
+	}
+
+	if err := applyTolerances(state.Changes, g.Tolerances, data, state.ApprovedSnapshot.Baseline); err != nil {
+		response.Fatal(rsp, err)
+		return err
+	}
+	return nil
+}
+
+// evaluateAutoApproval evaluates the gate's auto-approval rules against the
+// change, and records the rule that approved it
+func (f *Function) evaluateAutoApproval(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, state *approvalState, rsp *fnv1.RunFunctionResponse) error {
+	rules, err := compileRules(g.AutoApprove)
 	if err != nil {
-		return "", "", false, err
+		response.Fatal(rsp, err)
+		return err
 	}
 
-	// Check approval status
-	approved, err = f.checkApprovalStatus(req, in, rsp)
+	oxr, err := request.GetObservedCompositeResource(req)
 	if err != nil {
-		return "", "", false, err
+		response.Fatal(rsp, errors.Wrap(err, "cannot get observed composite resource"))
+		return err
+	}
+
+	vars := ruleVars(state.ApprovedSnapshot, newSnapshot(state.NewHash, state.Fields), state.Fields, state.Changes, oxr.Resource.Object)
+	name, errs := evaluateRules(rules, vars)
+	for _, err := range errs {
+		f.log.Info("Cannot evaluate auto-approval rule", "gate", g.Name, "error", err)
 	}
+	state.RuleErrors = errs
 
-	return newHash, currentHash, approved, nil
+	if name != "" {
+		f.log.Info("Changes approved by auto-approval rule", "gate", g.Name, "rule", name)
+		state.AutoApproval = "Approved by auto-approval rule " + name
+	}
+	return nil
 }
 
 // needsApproval determines if the changes require approval
-func (f *Function) needsApproval(approved bool, currentHash, newHash string) bool {
+func (f *Function) needsApproval(state *approvalState) bool {
 	// Only require approval if not approved AND there are changes
-	return !approved && (currentHash == "" || currentHash != newHash)
+	if state.Approval.Approved || state.AutoApproval != "" {
+		return false
+	}
+	return state.CurrentHash == "" || state.CurrentHash != state.NewHash
 }
 
-// handleUnapprovedChanges processes the case where changes need approval
-func (f *Function) handleUnapprovedChanges(_ *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse, currentHash, newHash string) {
+// handleUnapprovedChanges processes the case where changes need approval. It
+// enforces the gate's enforcement mode, and returns the message explaining
+// why the gate holds up the change.
+func (f *Function) handleUnapprovedChanges(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse, state *approvalState, pauses pauseDecisions) (string, error) {
+	approval, currentHash, newHash := state.Approval, state.CurrentHash, state.NewHash
+
 	// Set condition to show approval is needed
 	msg := "Changes detected. Approval required."
-	if in.ApprovalMessage != nil {
-		msg = *in.ApprovalMessage
+	if g.ApprovalMessage != nil {
+		msg = *g.ApprovalMessage
+	}
+
+	reason := "WaitingForApproval"
+	if state.TamperedHash != "" {
+		// The approved hash was written by someone else, so the change is
+		// gated again no matter what it was
+		reason = "HashTampered"
+		msg += "\nApproved hash " + state.TamperedHash + " is not sealed with the hash key. It was modified outside this function, or stored before a hash key was configured."
+		response.Warning(rsp, errors.Errorf("approved hash %s in %s is not sealed with the hash key", state.TamperedHash, *g.CurrentHashField)).
+			TargetCompositeAndClaim()
+	}
+	if approval.Progress != "" {
+		// Show how far the quorum got, even without detailed conditions
+		if len(approval.Approvers) > 0 {
+			reason = "WaitingForQuorum"
+		}
+		msg += "\n" + approval.Progress
+	}
+	if approval.Stale {
+		// An approval exists, but it was given for a different change
+		reason = "StaleApproval"
+		switch {
+		case approval.Records && g.ApprovalObjects != nil:
+			_, kind := approvalObjectsKind(g.ApprovalObjects)
+			msg += "\nApproval objects of kind " + kind + " approve hash " + strings.Join(approval.ApprovedHashes, ", ") + ", not the pending hash " + newHash
+		case approval.Records:
+			msg += "\nApprover records in " + *g.ApprovalField + " approve hash " + strings.Join(approval.ApprovedHashes, ", ") + ", not the pending hash " + newHash
+		case approval.Consumed != "":
+			msg += "\nApproval in " + *g.ApprovalField + " was already used to approve hash " + approval.Consumed + ". Remove it or set it to false, then approve again"
+		case approval.Hash != "":
+			msg += "\nApproval for hash " + approval.Hash + " does not match the pending hash " + newHash
+		default:
+			givenFor := "for pending hash " + approval.Pending
+			if approval.Pending == "" {
+				givenFor = "while no change was pending"
+			}
+			if gateApprovalSource(g) != approvalSourceStatus {
+				msg += "\nApproval in " + *g.ApprovalField + " was given " + givenFor + ", before the pending hash " + newHash + " was published. Remove it or set it to false, then approve again"
+			} else {
+				msg += "\nApproval was given " + givenFor + ", before the pending hash " + newHash + " was published. It was withdrawn, approve again"
+			}
+		}
+	}
+	if len(approval.Rejected) > 0 {
+		// Approvals were given by someone who may not approve
+		reason = "ApproverRejected"
+		msg += "\nRejected approvals:\n- " + strings.Join(approval.Rejected, "\n- ")
+		response.Warning(rsp, errors.Errorf("rejected approvals in %s: %s", *g.ApprovalField, strings.Join(approval.Rejected, "; "))).
+			TargetCompositeAndClaim()
 	}
 
 	detailedMsg := msg
-	if in.DetailedCondition != nil && *in.DetailedCondition {
+	if g.DetailedCondition != nil && *g.DetailedCondition {
 		// Add detailed information about what changed and what needs approval
+		howToApprove := "Approve this change by setting " + *g.ApprovalField + " to " + newHash
+		switch {
+		case g.ApprovalObjects != nil:
+			_, kind := approvalObjectsKind(g.ApprovalObjects)
+			howToApprove = "Approve this change by creating a " + kind + " labelled " + xrUIDLabel + "=<XR UID> with your name, group and the hash " + newHash + " in " + approvalObjectsField(g.ApprovalObjects)
+		case requiresRecords(g):
+			howToApprove = "Approve this change by adding a record with your name, group and the hash " + newHash + " to " + *g.ApprovalField
+		}
 		detailedMsg = msg + "\nCurrent hash: " + newHash + "\n" +
 			"Approved hash: " + currentHash + "\n" +
-			"Approve this change by setting " + *in.ApprovalField + " to true"
+			howToApprove + "\n" +
+			"Approval source: " + describeApprovalSource(g)
+
+		if state.FieldHashes != nil {
+			detailedMsg += "\n" + describeFieldChanges(state)
+		}
+
+		if ignored := changedIgnoredFields(state); len(ignored) > 0 {
+			detailedMsg += "\nIgnored fields changed without requiring approval:\n- " + strings.Join(ignored, "\n- ")
+		}
+
+		if state.ApprovedSnapshot != nil {
+			detailedMsg += "\n" + describeChanges(state.Changes)
+			if classes := requiredClasses(state.Changes, g); len(classes) > 0 {
+				detailedMsg += "\nChange classes requiring approval: " + strings.Join(classes, ", ")
+			}
+		}
+
+		for _, err := range state.RuleErrors {
+			detailedMsg += "\n" + err.Error()
+		}
 	}
 
-	// Set custom ApprovalRequired condition for status/feedback
-	response.ConditionFalse(rsp, "ApprovalRequired", "WaitingForApproval").
-		WithMessage(detailedMsg).
-		TargetCompositeAndClaim()
+	// Publish the hash we are waiting on so approvals can be bound to it
+	if err := f.savePendingHash(g, newHash, rsp); err != nil {
+		return "", err
+	}
+
+	// A stale approval of true would approve the hash we just published on
+	// the next run, without anyone having reviewed it
+	if approval.Withdraw {
+		if err := f.withdrawStaleApproval(g, approval, newHash, rsp); err != nil {
+			return "", err
+		}
+	}
+
+	if g.PatchField != nil {
+		if err := f.savePendingPatch(g, state, rsp); err != nil {
+			return "", err
+		}
+	}
+
+	if holdsResources(g) {
+		held, withheld, err := f.holdResources(req, g, rsp, state)
+		if err != nil {
+			return "", err
+		}
+		if len(held) > 0 {
+			detailedMsg += "\nResources awaiting approval:\n- " + strings.Join(held, "\n- ")
+			response.Warning(rsp, errors.Errorf("changes to composed resources %s are held until they are approved", strings.Join(held, ", "))).
+				TargetCompositeAndClaim()
+		}
+		if len(withheld) > 0 {
+			detailedMsg += "\nNew resources awaiting approval:\n- " + strings.Join(withheld, "\n- ")
+		}
+		if len(held) == 0 && len(withheld) == 0 {
+			detailedMsg += "\nNo composed resources are affected by the change"
+		}
+	}
+
+	if *g.Enforcement == v1beta1.EnforcementPause {
+		paused, err := f.pauseResources(req, g, rsp, state, pauses)
+		if err != nil {
+			return "", err
+		}
+		if len(paused) > 0 {
+			detailedMsg += "\nResources paused until the change is approved:\n- " + strings.Join(paused, "\n- ")
+			response.Warning(rsp, errors.Errorf("composed resources %s are paused until the change is approved", strings.Join(paused, ", "))).
+				TargetCompositeAndClaim()
+		} else {
+			detailedMsg += "\nNo composed resources are affected by the change"
+		}
+	}
+
+	if *g.Enforcement == v1beta1.EnforcementWarning {
+		// Only report the change, so we can tell how often approval would be
+		// required before enforcing it
+		count, err := f.recordAudit(req, g, rsp, state, reason)
+		if err != nil {
+			return "", err
+		}
+
+		response.ConditionTrue(rsp, auditConditionType(g), reason).
+			WithMessage(detailedMsg).
+			TargetCompositeAndClaim()
+
+		warning := errors.Errorf("changes would require approval, but enforcement is %s. Pending hash: %s", v1beta1.EnforcementWarning, newHash)
+		if g.Name != "" {
+			warning = errors.Wrapf(warning, "gate %s", g.Name)
+		}
+		response.Warning(rsp, warning).TargetCompositeAndClaim()
+
+		f.log.Info("Changes would require approval", "gate", g.Name, "message", msg, "count", count)
+	} else {
+		// Set custom ApprovalRequired condition for status/feedback
+		response.ConditionFalse(rsp, *g.ConditionType, reason).
+			WithMessage(detailedMsg).
+			TargetCompositeAndClaim()
+
+		f.log.Info("Changes require approval", "gate", g.Name, "message", msg)
+	}
 
-	// Use response.Fatal to halt the pipeline execution
-	// This stops the composition process entirely until approval is granted
-	f.log.Info("Halting pipeline until changes are approved", "message", msg)
-	response.Fatal(rsp, errors.New(detailedMsg))
+	if g.Name != "" {
+		return "Gate " + g.Name + ": " + detailedMsg, nil
+	}
+	return detailedMsg, nil
 }
 
 // handleApprovedChanges processes the case where changes are approved
-func (f *Function) handleApprovedChanges(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse, newHash string) error {
+func (f *Function) handleApprovedChanges(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse, state *approvalState, pauses pauseDecisions) error {
+	if *g.Enforcement == v1beta1.EnforcementPause {
+		if err := f.unpauseResources(req, g, rsp, pauses); err != nil {
+			return err
+		}
+	}
+
 	// If we got here, the changes are approved or there are no changes
 	// Update the current hash to the new hash
-	if err := f.saveCurrentHash(req, in, newHash, rsp); err != nil {
+	if err := f.saveCurrentHash(g, state, rsp); err != nil {
 		return err
 	}
 
-	// Set success condition
-	response.ConditionTrue(rsp, "FunctionSuccess", "Success").
-		WithMessage("Approved successfully").
-		TargetCompositeAndClaim()
+	msg := "Approved hash: " + state.NewHash
+	if state.Approval.Approved {
+		msg += "\nApproval source: " + describeApprovalSource(g)
+		f.log.Info("Approval found", "gate", g.Name, "source", gateApprovalSource(g), "field", *g.ApprovalField, "hash", state.NewHash)
+	}
+	if len(state.Approval.Approvers) > 0 {
+		msg += "\nApproved by: " + strings.Join(state.Approval.Approvers, ", ")
+		f.log.Info("Changes approved", "gate", g.Name, "approvers", state.Approval.Approvers)
+	}
+	if state.AutoApproval != "" {
+		msg += "\n" + state.AutoApproval
+		response.Normalf(rsp, "Changes approved without an approval: %s", state.AutoApproval).
+			TargetComposite()
+	}
+	if ignored := changedIgnoredFields(state); len(ignored) > 0 {
+		// Let people know these changes went through without an approval
+		msg += "\nIgnored fields changed without requiring approval:\n- " + strings.Join(ignored, "\n- ")
+		response.Normalf(rsp, "Ignored fields changed without requiring approval: %s", strings.Join(ignored, ", ")).
+			TargetComposite()
+	}
+
+	if *g.Enforcement == v1beta1.EnforcementWarning {
+		if err := f.clearAudit(g, rsp); err != nil {
+			return err
+		}
+		response.ConditionFalse(rsp, auditConditionType(g), "Approved").
+			WithMessage(msg).
+			TargetCompositeAndClaim()
+	}
+
+	// Named gates always report their condition, so that each gate's state
+	// is visible when several gates are evaluated together. Any gate reports
+	// the approval it used, and the source it was read from.
+	if g.Name != "" || state.Approval.Approved {
+		response.ConditionTrue(rsp, *g.ConditionType, "Approved").
+			WithMessage(msg).
+			TargetCompositeAndClaim()
+	}
+
+	return nil
+}
+
+// parseInput parses the function input.
+func (f *Function) parseInput(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse) (*v1beta1.Input, error) {
+	in := &v1beta1.Input{}
+	if err := request.GetInput(req, in); err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot get Function input"))
+		return nil, err
+	}
+
+	return in, nil
+}
+
+// gateName matches valid gate names. Names are used in status paths,
+// condition types, label values and annotation keys, so they must be DNS
+// labels.
+var gateName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// maxGateNameLength is the longest gate name, the length of a DNS label
+const maxGateNameLength = 63
+
+// resolveGates returns the approval gates to evaluate with defaults set. If no
+// gates are listed the top-level input is evaluated as a single unnamed gate.
+func (f *Function) resolveGates(in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) ([]v1beta1.Gate, error) {
+	if len(in.Gates) == 0 {
+		g := v1beta1.Gate{GateSpec: *in.GateSpec.DeepCopy()}
+		setGateDefaults(&g, "status", "ApprovalRequired")
+		if err := validateGate(&g); err != nil {
+			response.Fatal(rsp, err)
+			return nil, err
+		}
+		return []v1beta1.Gate{g}, nil
+	}
+
+	// What a gate watches is its own, so top-level settings of the watched
+	// data would be ignored
+	if in.DataField != "" || len(in.DataFields) > 0 || in.DesiredResources != nil || len(in.IgnorePaths) > 0 || in.Normalization != nil {
+		response.Fatal(rsp, errors.New("dataField, dataFields, desiredResources, ignorePaths and normalization cannot be combined with gates"))
+		return nil, errors.New("data fields combined with gates")
+	}
+
+	gates := make([]v1beta1.Gate, 0, len(in.Gates))
+	owners := make(map[string]string)
+	names := make(map[string]bool)
+	for i := range in.Gates {
+		g := *in.Gates[i].DeepCopy()
+		if g.Name == "" {
+			response.Fatal(rsp, errors.Errorf("gate %d has no name", i))
+			return nil, errors.New("gate has no name")
+		}
+		if len(g.Name) > maxGateNameLength || !gateName.MatchString(g.Name) {
+			response.Fatal(rsp, errors.Errorf("gate name %q must be a DNS label of lowercase letters, digits and hyphens", g.Name))
+			return nil, errors.New("invalid gate name")
+		}
+		if names[g.Name] {
+			response.Fatal(rsp, errors.Errorf("gate %s is listed more than once", g.Name))
+			return nil, errors.New("duplicate gate name")
+		}
+		names[g.Name] = true
+
+		// Gates inherit presentation and policy settings from the top level
+		if g.DetailedCondition == nil {
+			g.DetailedCondition = in.DetailedCondition
+		}
+		if g.ApprovalMessage == nil {
+			g.ApprovalMessage = in.ApprovalMessage
+		}
+		if g.MissingFieldPolicy == nil {
+			g.MissingFieldPolicy = in.MissingFieldPolicy
+		}
+		if g.HashAlgorithm == nil {
+			g.HashAlgorithm = in.HashAlgorithm
+		}
+		if g.HashKey == nil {
+			g.HashKey = in.HashKey
+		}
+		if g.MaxSnapshotSize == nil {
+			g.MaxSnapshotSize = in.MaxSnapshotSize
+		}
+		if g.RequireApprovalFor == nil {
+			g.RequireApprovalFor = in.RequireApprovalFor
+		}
+		if g.Enforcement == nil {
+			g.Enforcement = in.Enforcement
+		}
+		if g.EnforcementOverrides == nil {
+			g.EnforcementOverrides = in.EnforcementOverrides
+		}
+		if g.MaxApprovedResourcesSize == nil {
+			g.MaxApprovedResourcesSize = in.MaxApprovedResourcesSize
+		}
+		if g.Tolerances == nil {
+			g.Tolerances = in.Tolerances
+		}
+		if g.AutoApprove == nil {
+			g.AutoApprove = in.AutoApprove
+		}
+		if g.Quorum == nil {
+			g.Quorum = in.Quorum
+		}
+		if g.ApproverDirectory == nil {
+			g.ApproverDirectory = in.ApproverDirectory
+		}
+		if g.ApprovalSignatures == nil {
+			g.ApprovalSignatures = in.ApprovalSignatures
+		}
+		if g.ApprovalObjects == nil {
+			g.ApprovalObjects = in.ApprovalObjects
+		}
+
+		setGateDefaults(&g, "status.gates."+g.Name, gateConditionType(g.Name))
+		if err := validateGate(&g); err != nil {
+			response.Fatal(rsp, errors.Wrapf(err, "invalid gate %s", g.Name))
+			return nil, err
+		}
+
+		// Gates sharing status fields would silently clobber each other
+		fields := []string{*g.ApprovalField, *g.CurrentHashField, *g.PendingHashField, *g.FieldHashesField, *g.IgnoredHashesField, *g.HashSettingsField, *g.SnapshotField, *g.ResourceHashesField, *g.ApprovedResourcesField, *g.PausedResourcesField, *g.AuditField, *g.ConsumedApprovalField}
+		if g.PatchField != nil {
+			fields = append(fields, *g.PatchField)
+		}
+		for _, field := range fields {
+			if owner, taken := owners[field]; taken {
+				response.Fatal(rsp, errors.Errorf("gates %s and %s both use status field %s", owner, g.Name, field))
+				return nil, errors.New("gates share a status field")
+			}
+			owners[field] = g.Name
+		}
+
+		gates = append(gates, g)
+	}
+
+	return gates, nil
+}
+
+// setGateDefaults sets default values for anything the gate doesn't specify.
+// Status fields default to fields under the supplied prefix.
+func setGateDefaults(g *v1beta1.Gate, prefix, conditionType string) {
+	if g.ConditionType == nil {
+		g.ConditionType = &conditionType
+	}
+
+	if g.ApprovalField == nil {
+		defaultField := prefix + ".approved"
+		g.ApprovalField = &defaultField
+	}
+
+	if g.ConsumedApprovalField == nil {
+		defaultField := prefix + ".consumedApproval"
+		g.ConsumedApprovalField = &defaultField
+	}
+
+	if g.CurrentHashField == nil {
+		defaultField := prefix + ".currentHash"
+		g.CurrentHashField = &defaultField
+	}
+
+	if g.PendingHashField == nil {
+		defaultField := prefix + ".pendingHash"
+		g.PendingHashField = &defaultField
+	}
+
+	if g.FieldHashesField == nil {
+		defaultField := prefix + ".fieldHashes"
+		g.FieldHashesField = &defaultField
+	}
+
+	if g.IgnoredHashesField == nil {
+		defaultField := prefix + ".ignoredHashes"
+		g.IgnoredHashesField = &defaultField
+	}
+
+	if g.HashSettingsField == nil {
+		defaultField := prefix + ".hashSettings"
+		g.HashSettingsField = &defaultField
+	}
+
+	if g.SnapshotField == nil {
+		defaultField := prefix + ".approvedSnapshot"
+		g.SnapshotField = &defaultField
+	}
+
+	if g.ResourceHashesField == nil {
+		defaultField := prefix + ".resourceHashes"
+		g.ResourceHashesField = &defaultField
+	}
+
+	if g.ApprovedResourcesField == nil {
+		defaultField := prefix + ".approvedResources"
+		g.ApprovedResourcesField = &defaultField
+	}
+
+	if g.PausedResourcesField == nil {
+		defaultField := prefix + ".pausedResources"
+		g.PausedResourcesField = &defaultField
+	}
+
+	if g.AuditField == nil {
+		defaultField := prefix + ".audit"
+		g.AuditField = &defaultField
+	}
+
+	if g.MaxApprovedResourcesSize == nil {
+		defaultSize := defaultMaxApprovedResourcesSize
+		g.MaxApprovedResourcesSize = &defaultSize
+	}
+
+	if g.MaxSnapshotSize == nil {
+		defaultSize := defaultMaxSnapshotSize
+		g.MaxSnapshotSize = &defaultSize
+	}
+
+	if g.MissingFieldPolicy == nil {
+		defaultPolicy := v1beta1.MissingFieldPolicyFatal
+		g.MissingFieldPolicy = &defaultPolicy
+	}
+
+	if g.HashAlgorithm == nil {
+		defaultAlgorithm := v1beta1.HashAlgorithmSHA256
+		g.HashAlgorithm = &defaultAlgorithm
+	}
+
+	if g.Enforcement == nil {
+		defaultEnforcement := v1beta1.EnforcementFatal
+		g.Enforcement = &defaultEnforcement
+	}
+
+	if g.RequireApprovalFor == nil {
+		g.RequireApprovalFor = []string{v1beta1.ChangeClassAdditive, v1beta1.ChangeClassModifying, v1beta1.ChangeClassDestructive}
+	}
+
+	if g.DetailedCondition == nil {
+		defaultValue := true
+		g.DetailedCondition = &defaultValue
+	}
+}
+
+// validateGate checks settings that can't be enforced by the input's schema,
+// since the schema isn't installed as a CRD
+func validateGate(g *v1beta1.Gate) error {
+	if _, ok := hashFuncs[*g.HashAlgorithm]; !ok {
+		return errors.Errorf("unknown hash algorithm %q", *g.HashAlgorithm)
+	}
+
+	if !slices.Contains(enforcementModes, *g.Enforcement) {
+		return errors.Errorf("unknown enforcement %q", *g.Enforcement)
+	}
+	for _, mode := range g.EnforcementOverrides {
+		if !slices.Contains(enforcementModes, mode) {
+			return errors.Errorf("unknown enforcement override %q", mode)
+		}
+	}
+
+	for _, class := range g.RequireApprovalFor {
+		switch class {
+		case v1beta1.ChangeClassAdditive, v1beta1.ChangeClassModifying, v1beta1.ChangeClassDestructive:
+		default:
+			return errors.Errorf("unknown change class %q", class)
+		}
+	}
+
+	for _, t := range g.Tolerances {
+		if err := validateTolerance(t); err != nil {
+			return err
+		}
+	}
+
+	if _, err := compileRules(g.AutoApprove); err != nil {
+		return err
+	}
+
+	if g.Quorum != nil {
+		if err := validateQuorum(g.Quorum); err != nil {
+			return err
+		}
+	}
+
+	if g.ApproverDirectory != nil {
+		if err := validateApproverDirectory(g.ApproverDirectory); err != nil {
+			return err
+		}
+	}
+
+	if g.ApprovalSignatures != nil {
+		if err := validateApprovalSignatures(g.ApprovalSignatures); err != nil {
+			return err
+		}
+	}
+
+	if g.ApprovalObjects != nil {
+		if err := validateApprovalObjects(g.ApprovalObjects); err != nil {
+			return err
+		}
+	}
+
+	if k := g.HashKey; k != nil {
+		if (k.CredentialsName == "") == (k.File == "") {
+			return errors.New("hashKey must set exactly one of credentialsName and file")
+		}
+		if *g.HashAlgorithm == v1beta1.HashAlgorithmXXHash {
+			return errors.New("hashKey cannot be used with the xxhash algorithm")
+		}
+	}
+	return nil
+}
+
+// gateConditionType returns the default condition type for a named gate, e.g.
+// "CostLimitsApprovalRequired" for a gate named "cost-limits"
+func gateConditionType(name string) string {
+	var b strings.Builder
+	for _, word := range strings.Split(name, "-") {
+		if word == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	b.WriteString("ApprovalRequired")
+	return b.String()
+}
+
+// initializeResponse initializes the response with desired XR and preserves context
+func (f *Function) initializeResponse(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse) error {
+	// Ensure oxr to dxr gets propagated and we keep status around
+	if err := f.propagateDesiredXR(req, rsp); err != nil {
+		return err
+	}
+
+	// Ensure the context is preserved
+	f.preserveContext(req, rsp)
+
+	return nil
+}
+
+// getXRAndStatus retrieves status and desired XR, handling initialization if needed
+func (f *Function) getXRAndStatus(req *fnv1.RunFunctionRequest) (map[string]interface{}, *resource.Composite, error) {
+	// Get composite resources
+	oxr, dxr, err := f.getObservedAndDesired(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Initialize and copy data
+	f.initializeAndCopyData(oxr, dxr)
+
+	// Get status
+	xrStatus := f.getStatusFromResources(oxr, dxr)
+
+	return xrStatus, dxr, nil
+}
+
+// getObservedAndDesired gets both observed and desired XR resources
+func (f *Function) getObservedAndDesired(req *fnv1.RunFunctionRequest) (*resource.Composite, *resource.Composite, error) {
+	oxr, err := request.GetObservedCompositeResource(req)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot get observed composite resource")
+	}
+
+	dxr, err := request.GetDesiredCompositeResource(req)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot get desired composite resource")
+	}
+
+	return oxr, dxr, nil
+}
+
+// initializeAndCopyData initializes metadata and copies spec
+func (f *Function) initializeAndCopyData(oxr, dxr *resource.Composite) {
+	// Initialize dxr from oxr if needed
+	if dxr.Resource.GetKind() == "" {
+		dxr.Resource.SetAPIVersion(oxr.Resource.GetAPIVersion())
+		dxr.Resource.SetKind(oxr.Resource.GetKind())
+		dxr.Resource.SetName(oxr.Resource.GetName())
+	}
+
+	// Copy spec from observed to desired XR to preserve it
+	xrSpec := make(map[string]interface{})
+	if err := oxr.Resource.GetValueInto("spec", &xrSpec); err == nil && len(xrSpec) > 0 {
+		if err := dxr.Resource.SetValue("spec", xrSpec); err != nil {
+			f.log.Debug("Cannot set spec in desired XR", "error", err)
+		}
+	}
+}
+
+// getStatusFromResources gets status from desired or observed XR
+func (f *Function) getStatusFromResources(oxr, dxr *resource.Composite) map[string]interface{} {
+	xrStatus := make(map[string]interface{})
+
+	// First try to get status from desired XR (pipeline changes)
+	if dxr.Resource.GetKind() != "" {
+		err := dxr.Resource.GetValueInto("status", &xrStatus)
+		if err == nil && len(xrStatus) > 0 {
+			return xrStatus
+		}
+		f.log.Debug("Cannot get status from Desired XR or it's empty")
+	}
+
+	// Fallback to observed XR status
+	err := oxr.Resource.GetValueInto("status", &xrStatus)
+	if err != nil {
+		f.log.Debug("Cannot get status from Observed XR")
+	}
+
+	return xrStatus
+}
+
+// propagateDesiredXR ensures the desired XR is properly propagated without changing existing data
+func (f *Function) propagateDesiredXR(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse) error {
+	xrStatus, dxr, err := f.getXRAndStatus(req)
+	if err != nil {
+		response.Fatal(rsp, err)
+		return err
+	}
+
+	// Write any existing status back to dxr
+	if len(xrStatus) > 0 {
+		if err := dxr.Resource.SetValue("status", xrStatus); err != nil {
+			f.log.Info("Error setting status in Desired XR", "error", err)
+			return err
+		}
+	}
+
+	// Save the desired XR in the response
+	if err := response.SetDesiredCompositeResource(rsp, dxr); err != nil {
+		response.Fatal(rsp, errors.Wrapf(err, "cannot set desired composite resource in %T", rsp))
+		return err
+	}
+
+	f.log.Info("Successfully propagated Desired XR")
+	return nil
+}
+
+// preserveContext ensures the context is preserved in the response
+func (f *Function) preserveContext(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse) {
+	// Get the existing context from the request
+	existingContext := req.GetContext()
+	if existingContext != nil {
+		// Copy the existing context to the response
+		rsp.Context = existingContext
+		f.log.Info("Preserved existing context in response")
+	}
+}
+
+// watchedField is a single field of the desired XR that is watched for changes
+type watchedField struct {
+	// Path is the field path, as configured in the input
+	Path string
+
+	// Value is the value found at the path
+	Value interface{}
+
+	// Missing is true if the path was not found and treated as empty
+	Missing bool
+
+	// Pattern is true if the path has wildcards or filters, and can match
+	// several fields
+	Pattern bool
+
+	// Matches are the concrete fields matched by a pattern, in order
+	Matches []PathMatch
+}
+
+// matches returns the concrete fields that make up this watched field
+func (w watchedField) matches() []PathMatch {
+	if w.Pattern {
+		return w.Matches
+	}
+	return []PathMatch{{Path: w.Path, Value: w.Value}}
+}
+
+// dataFields returns the configured fields to watch, in the order given
+func dataFields(g *v1beta1.Gate) []string {
+	fields := make([]string, 0, len(g.DataFields)+1)
+	if g.DataField != "" {
+		fields = append(fields, g.DataField)
+	}
+	for _, field := range g.DataFields {
+		if field != g.DataField {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// extractDataToHash extracts the data to hash from the fields defined in the
+// input. Ignored paths are stripped and the data is normalized before the
+// fields are extracted, and the ignored fields within the watched data are
+// returned separately.
+func (f *Function) extractDataToHash(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse) ([]watchedField, []PathMatch, error) {
+	dxr, err := request.GetDesiredCompositeResource(req)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot get desired composite resource"))
+		return nil, nil, err
+	}
+
+	paths := dataFields(g)
+	if len(paths) == 0 && g.DesiredResources == nil {
+		response.Fatal(rsp, errors.New("either dataField, dataFields or desiredResources must be specified"))
+		return nil, nil, errors.New("no data fields specified")
+	}
+
+	// Strip ignored paths from a copy, so they don't affect the hash
+	data := runtime.DeepCopyJSON(dxr.Resource.UnstructuredContent())
+	ignored, err := stripIgnoredPaths(data, g.IgnorePaths)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot strip ignored paths"))
+		return nil, nil, err
+	}
+
+	// An approval in spec or an annotation is never hashed, since giving it
+	// would change the hash it approves
+	if src := gateApprovalSource(g); src == approvalSourceSpec || src == approvalSourceAnnotation {
+		if err := DeleteNestedValue(data, *g.ApprovalField); err != nil {
+			response.Fatal(rsp, errors.Wrapf(err, "cannot remove approval field %s", *g.ApprovalField))
+			return nil, nil, err
+		}
+	}
+
+	// Lists treated as sets are put in a canonical order before they are
+	// extracted, so set paths can point anywhere in the XR
+	if err := normalizeSets(data, g.Normalization); err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot normalize sets"))
+		return nil, nil, err
+	}
+
+	fields := make([]watchedField, 0, len(paths))
+	for _, path := range paths {
+		field, err := f.extractField(data, g, path, rsp)
+		if err != nil {
+			return nil, nil, err
+		}
+		fields = append(fields, field)
+	}
+
+	if g.DesiredResources != nil {
+		field, resourceIgnored, err := f.extractDesiredResources(req, g)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot extract desired composed resources"))
+			return nil, nil, err
+		}
+		fields = append(fields, field)
+		ignored = append(ignored, resourceIgnored...)
+	}
+
+	return fields, ignoredWithin(ignored, fields), nil
+}
+
+// extractDataWithSettings extracts the data to hash with the supplied ignore
+// paths and normalization instead of the gate's own
+func (f *Function) extractDataWithSettings(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, s hashSettings) (interface{}, error) {
+	// Any errors were already reported when extracting the data to hash, so
+	// they are not reported again
+	fields, _, err := f.extractDataToHash(req, withHashSettings(g, s), &fnv1.RunFunctionResponse{})
+	if err != nil {
+		return nil, err
+	}
+	return combineFields(fields), nil
+}
+
+// stripIgnoredPaths removes every field matched by the ignore paths from the
+// supplied data, and returns the removed fields
+func stripIgnoredPaths(data map[string]interface{}, ignorePaths []string) ([]PathMatch, error) {
+	var ignored []PathMatch
+	for _, path := range ignorePaths {
+		matches, err := ExpandPath(data, path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid ignore path %s", path)
+		}
+
+		// Delete in reverse so removing a list element doesn't shift the
+		// index of elements that are still to be removed
+		for i := len(matches) - 1; i >= 0; i-- {
+			if err := DeleteNestedValue(data, matches[i].Path); err != nil {
+				return nil, errors.Wrapf(err, "cannot remove ignored field %s", matches[i].Path)
+			}
+		}
+
+		ignored = append(ignored, matches...)
+	}
+	return ignored, nil
+}
+
+// ignoredWithin returns the ignored fields that were stripped from within the
+// watched fields. Ignored fields elsewhere in the XR are of no interest.
+func ignoredWithin(ignored []PathMatch, fields []watchedField) []PathMatch {
+	var within []PathMatch
+	for _, m := range ignored {
+		for _, field := range fields {
+			if isWithinAny(m.Path, field.matches()) {
+				within = append(within, m)
+				break
+			}
+		}
+	}
+	return within
+}
+
+// isWithinAny returns true if the path is within any of the matched fields
+func isWithinAny(path string, matches []PathMatch) bool {
+	for _, m := range matches {
+		if IsPathWithin(path, m.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// changedIgnoredFields returns the ignored fields that changed since the last
+// approval, in order
+func changedIgnoredFields(state *approvalState) []string {
+	if state.IgnoredHashes == nil || state.ApprovedIgnoredHashes == nil {
+		return nil
+	}
+
+	var changed []string
+	for _, m := range state.Ignored {
+		if approved, known := state.ApprovedIgnoredHashes[m.Path]; !known || !sameHash(approved, state.IgnoredHashes[m.Path]) {
+			changed = append(changed, m.Path)
+		}
+	}
+
+	var removed []string
+	for path := range state.ApprovedIgnoredHashes {
+		if _, exists := state.IgnoredHashes[path]; !exists {
+			removed = append(removed, path)
+		}
+	}
+	SortPaths(removed)
+
+	return append(changed, removed...)
+}
+
+// extractField extracts a single watched field from the desired XR data
+func (f *Function) extractField(data map[string]interface{}, g *v1beta1.Gate, path string, rsp *fnv1.RunFunctionResponse) (watchedField, error) {
+	f.log.Debug("Calculating hash from field", "dataField", path)
+
+	segments, err := ParseNestedKey(path)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrapf(err, "error accessing field %s", path))
+		return watchedField{}, err
+	}
+
+	if IsPathPattern(segments) {
+		matches, err := ExpandPath(data, path)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrapf(err, "error accessing field %s", path))
+			return watchedField{}, err
+		}
+
+		// The hash covers the matched paths as well as their values, so that
+		// a value moving from one matched path to another is a change. A
+		// pattern that matches nothing is watched as an empty list.
+		values := make([]interface{}, 0, len(matches))
+		for i, m := range matches {
+			m.Value = normalizeValue(m.Value, g.Normalization)
+			matches[i] = m
+			values = append(values, map[string]interface{}{"path": m.Path, "value": m.Value})
+		}
+
+		return watchedField{Path: path, Value: values, Pattern: true, Matches: matches}, nil
+	}
+
+	value, exists, err := GetNestedValue(data, path)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrapf(err, "error accessing field %s", path))
+		return watchedField{}, err
+	}
+
+	if !exists {
+		if *g.MissingFieldPolicy == v1beta1.MissingFieldPolicyEmpty {
+			f.log.Debug("Treating missing field as empty", "dataField", path)
+			return watchedField{Path: path, Missing: true}, nil
+		}
+
+		response.Fatal(rsp, errors.Errorf("field %s not found in resource", path))
+		return watchedField{}, errors.New("field not found")
+	}
+
+	return watchedField{Path: path, Value: normalizeValue(value, g.Normalization)}, nil
+}
+
+// combineFields returns the data to hash for the supplied fields. A single
+// field is hashed on its own, so that existing hashes stay valid. Multiple
+// fields are hashed as a map keyed by path, which is marshaled in sorted key
+// order and is therefore independent of the order the fields are listed in.
+func combineFields(fields []watchedField) interface{} {
+	if len(fields) == 1 {
+		return fields[0].Value
+	}
+
+	combined := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		combined[field.Path] = field.Value
+	}
+	return combined
+}
+
+// describeFieldChanges renders a per-field breakdown of what changed since
+// the last approval
+func describeFieldChanges(state *approvalState) string {
+	var b strings.Builder
+	b.WriteString("Watched fields:")
+
+	seen := make(map[string]bool)
+	for _, field := range state.Fields {
+		if !field.Pattern {
+			seen[field.Path] = true
+			b.WriteString("\n- " + field.Path + ": " + describeFieldChange(state, field.Path))
+			if field.Missing {
+				b.WriteString(" (missing, treated as empty)")
+			}
+			continue
+		}
+
+		b.WriteString("\n- " + field.Path + ": " + strconv.Itoa(len(field.Matches)) + " matched")
+		for _, m := range field.Matches {
+			seen[m.Path] = true
+			b.WriteString("\n  - " + m.Path + ": " + describeFieldChange(state, m.Path))
+		}
+	}
+
+	// Approved fields that are no longer matched have been removed
+	var removed []string
+	for path := range state.ApprovedFieldHashes {
+		if !seen[path] {
+			removed = append(removed, path)
+		}
+	}
+	SortPaths(removed)
+	for _, path := range removed {
+		b.WriteString("\n- " + path + ": removed")
+	}
+
+	return b.String()
+}
+
+// describeFieldChange describes how a single concrete field changed since the
+// last approval
+func describeFieldChange(state *approvalState, path string) string {
+	approved, known := state.ApprovedFieldHashes[path]
+	switch {
+	case state.ApprovedFieldHashes == nil:
+		return "not previously approved"
+	case !known:
+		return "added"
+	case !sameHash(approved, state.FieldHashes[path]):
+		return "changed"
+	default:
+		return "unchanged"
+	}
+}
+
+// calculateHash calculates the hash of the given data with the gate's hash
+// algorithm, in the form it is stored in
+func (f *Function) calculateHash(data interface{}, g *v1beta1.Gate) string {
+	digest, err := digestData(*g.HashAlgorithm, data)
+	if err != nil {
+		f.log.Debug("Error calculating hash", "error", err)
+		return ""
+	}
+
+	return storedHash{Algorithm: *g.HashAlgorithm, Version: hashVersion, Digest: digest}.String()
+}
+
+// getHashKey reads the key that seals approved hashes from the function's
+// credentials or from a file
+func (f *Function) getHashKey(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse) ([]byte, error) {
+	var key []byte
+	if name := g.HashKey.CredentialsName; name != "" {
+		creds, err := request.GetCredentials(req, name)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot get hash key credentials"))
+			return nil, err
+		}
+
+		dataKey := "key"
+		if g.HashKey.CredentialsKey != nil {
+			dataKey = *g.HashKey.CredentialsKey
+		}
+		key = creds.Data[dataKey]
+	} else {
+		data, err := os.ReadFile(g.HashKey.File)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot read hash key file"))
+			return nil, err
+		}
+		key = data
+	}
+
+	// Keys are often stored with a trailing newline
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		response.Fatal(rsp, errors.New("hash key is empty"))
+		return nil, errors.New("hash key is empty")
+	}
+
+	return key, nil
+}
+
+// getCurrentHash retrieves the currently approved hash
+func (f *Function) getCurrentHash(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse) (string, error) {
+	// A missing hash is not an error, it just means this is the first time
+	// we're seeing this resource
+	value, _, err := f.getStatusString(req, *g.CurrentHashField, rsp)
+	return value, err
+}
+
+// getHashes retrieves per-field hashes recorded in the supplied status field at
+// the last approval. It returns nil if none were recorded.
+func (f *Function) getHashes(req *fnv1.RunFunctionRequest, field string, rsp *fnv1.RunFunctionResponse) (map[string]string, error) {
+	xrStatus, _, err := f.getXRAndStatus(req)
+	if err != nil {
+		response.Fatal(rsp, err)
+		return nil, err
+	}
+
+	// Resolve the field relative to status
+	hashesField := trimStatusPrefix(field)
+
+	value, exists, err := GetNestedValue(xrStatus, hashesField)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrapf(err, "error accessing hashes field %s", hashesField))
+		return nil, err
+	}
+
+	values, ok := value.(map[string]interface{})
+	if !exists || !ok {
+		return nil, nil
+	}
 
-	return nil
+	hashes := make(map[string]string, len(values))
+	for path, v := range values {
+		if hash, ok := v.(string); ok {
+			hashes[path] = hash
+		}
+	}
+
+	return hashes, nil
 }
 
-// parseInput parses the function input and sets defaults.
-func (f *Function) parseInput(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse) (*v1beta1.Input, error) {
-	in := &v1beta1.Input{}
-	if err := request.GetInput(req, in); err != nil {
-		response.Fatal(rsp, errors.Wrap(err, "cannot get Function input"))
+// getHashSettings retrieves the ignore paths and normalization the approved
+// hash was computed with. It returns nil if none were recorded, or if the gate
+// has a hash key and they weren't sealed to the approved hash with it.
+func (f *Function) getHashSettings(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, state *approvalState, rsp *fnv1.RunFunctionResponse) (*hashSettings, error) {
+	xrStatus, _, err := f.getXRAndStatus(req)
+	if err != nil {
+		response.Fatal(rsp, err)
 		return nil, err
 	}
 
-	// Set default values if not provided
-	if in.ApprovalField == nil {
-		defaultField := "status.approved"
-		in.ApprovalField = &defaultField
+	// Resolve the field relative to status
+	settingsField := trimStatusPrefix(*g.HashSettingsField)
+
+	value, exists, err := GetNestedValue(xrStatus, settingsField)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrapf(err, "error accessing hash settings field %s", settingsField))
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
 	}
 
-	if in.CurrentHashField == nil {
-		defaultField := "status.currentHash"
-		in.CurrentHashField = &defaultField
+	var recorded recordedHashSettings
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = json.Unmarshal(data, &recorded)
+	}
+	if err != nil {
+		// Broken settings only mean the hash can't be upgraded
+		f.log.Info("Cannot decode hash settings", "gate", g.Name, "error", err)
+		return nil, nil
 	}
 
-	if in.DetailedCondition == nil {
-		defaultValue := true
-		in.DetailedCondition = &defaultValue
+	if state.HashKey != nil && !verifyHashSettings(recorded, state.CurrentHash, state.HashKey) {
+		f.log.Info("Hash settings are not sealed with the hash key", "gate", g.Name)
+		return nil, nil
 	}
 
-	return in, nil
+	return &recorded.hashSettings, nil
 }
 
-// initializeResponse initializes the response with desired XR and preserves context
-func (f *Function) initializeResponse(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse) error {
-	// Ensure oxr to dxr gets propagated and we keep status around
-	if err := f.propagateDesiredXR(req, rsp); err != nil {
-		return err
+// getApprovedSnapshot retrieves the snapshot of the watched data taken at the
+// last approval. It returns nil if there is no usable snapshot of the data
+// approved with the current hash. Changes are approved on their own based on
+// the snapshot, so if the gate has a hash key the snapshot must be sealed with
+// it.
+func (f *Function) getApprovedSnapshot(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, state *approvalState, rsp *fnv1.RunFunctionResponse) (*snapshot, error) {
+	encoded, _, err := f.getStatusString(req, *g.SnapshotField, rsp)
+	if err != nil || encoded == "" {
+		return nil, err
 	}
 
-	// Ensure the context is preserved
-	f.preserveContext(req, rsp)
-
-	return nil
-}
-
-// getXRAndStatus retrieves status and desired XR, handling initialization if needed
-func (f *Function) getXRAndStatus(req *fnv1.RunFunctionRequest) (map[string]interface{}, *resource.Composite, error) {
-	// Get composite resources
-	oxr, dxr, err := f.getObservedAndDesired(req)
+	s, err := decodeSnapshot(encoded)
 	if err != nil {
-		return nil, nil, err
+		// A broken snapshot only means we can't show what changed
+		f.log.Info("Cannot decode approved snapshot", "gate", g.Name, "error", err)
+		return nil, nil
 	}
 
-	// Initialize and copy data
-	f.initializeAndCopyData(oxr, dxr)
+	if !sameHash(s.Hash, state.CurrentHash) {
+		f.log.Debug("Approved snapshot was taken at another hash", "gate", g.Name, "snapshotHash", s.Hash)
+		return nil, nil
+	}
 
-	// Get status
-	xrStatus := f.getStatusFromResources(oxr, dxr)
+	if state.HashKey != nil && !verifySnapshot(s, state.HashKey) {
+		f.log.Info("Approved snapshot is not sealed with the hash key", "gate", g.Name)
+		return nil, nil
+	}
 
-	return xrStatus, dxr, nil
+	return s, nil
 }
 
-// getObservedAndDesired gets both observed and desired XR resources
-func (f *Function) getObservedAndDesired(req *fnv1.RunFunctionRequest) (*resource.Composite, *resource.Composite, error) {
-	oxr, err := request.GetObservedCompositeResource(req)
+// getStatusStrings retrieves a list of strings from the XR status. Values
+// that aren't strings are skipped.
+func (f *Function) getStatusStrings(req *fnv1.RunFunctionRequest, field string, rsp *fnv1.RunFunctionResponse) ([]string, error) {
+	xrStatus, _, err := f.getXRAndStatus(req)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "cannot get observed composite resource")
+		response.Fatal(rsp, err)
+		return nil, err
 	}
 
-	dxr, err := request.GetDesiredCompositeResource(req)
+	// Resolve the field relative to status
+	statusField := trimStatusPrefix(field)
+
+	value, _, err := GetNestedValue(xrStatus, statusField)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "cannot get desired composite resource")
+		response.Fatal(rsp, errors.Wrapf(err, "error accessing status field %s", statusField))
+		return nil, err
 	}
 
-	return oxr, dxr, nil
+	values, _ := value.([]interface{})
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out, nil
 }
 
-// initializeAndCopyData initializes metadata and copies spec
-func (f *Function) initializeAndCopyData(oxr, dxr *resource.Composite) {
-	// Initialize dxr from oxr if needed
-	if dxr.Resource.GetKind() == "" {
-		dxr.Resource.SetAPIVersion(oxr.Resource.GetAPIVersion())
-		dxr.Resource.SetKind(oxr.Resource.GetKind())
-		dxr.Resource.SetName(oxr.Resource.GetName())
+// getStatusString retrieves a string value from the XR status. The returned
+// bool reports whether the field exists at all.
+func (f *Function) getStatusString(req *fnv1.RunFunctionRequest, field string, rsp *fnv1.RunFunctionResponse) (string, bool, error) {
+	xrStatus, _, err := f.getXRAndStatus(req)
+	if err != nil {
+		response.Fatal(rsp, err)
+		return "", false, err
 	}
 
-	// Copy spec from observed to desired XR to preserve it
-	xrSpec := make(map[string]interface{})
-	if err := oxr.Resource.GetValueInto("spec", &xrSpec); err == nil && len(xrSpec) > 0 {
-		if err := dxr.Resource.SetValue("spec", xrSpec); err != nil {
-			f.log.Debug("Cannot set spec in desired XR", "error", err)
-		}
-	}
-}
+	// Resolve the field relative to status
+	statusField := trimStatusPrefix(field)
 
-// getStatusFromResources gets status from desired or observed XR
-func (f *Function) getStatusFromResources(oxr, dxr *resource.Composite) map[string]interface{} {
-	xrStatus := make(map[string]interface{})
+	value, exists, err := GetNestedValue(xrStatus, statusField)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrapf(err, "error accessing status field %s", statusField))
+		return "", false, err
+	}
 
-	// First try to get status from desired XR (pipeline changes)
-	if dxr.Resource.GetKind() != "" {
-		err := dxr.Resource.GetValueInto("status", &xrStatus)
-		if err == nil && len(xrStatus) > 0 {
-			return xrStatus
-		}
-		f.log.Debug("Cannot get status from Desired XR or it's empty")
+	if !exists {
+		return "", false, nil
 	}
 
-	// Fallback to observed XR status
-	err := oxr.Resource.GetValueInto("status", &xrStatus)
-	if err != nil {
-		f.log.Debug("Cannot get status from Observed XR")
+	strValue, ok := value.(string)
+	if !ok {
+		response.Fatal(rsp, errors.Errorf("status field %s is not a string", statusField))
+		return "", false, errors.New("status field is not a string")
 	}
 
-	return xrStatus
+	return strValue, true, nil
 }
 
-// propagateDesiredXR ensures the desired XR is properly propagated without changing existing data
-func (f *Function) propagateDesiredXR(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse) error {
-	xrStatus, dxr, err := f.getXRAndStatus(req)
-	if err != nil {
-		response.Fatal(rsp, err)
-		return err
+// saveCurrentHash updates the current hash with the new hash after approval
+func (f *Function) saveCurrentHash(g *v1beta1.Gate, state *approvalState, rsp *fnv1.RunFunctionResponse) error {
+	// Reset approval field since it's been processed. A hash approval is
+	// cleared rather than reset to false to keep the field's type stable.
+	var reset interface{} = false
+	if state.Approval.Hash != "" {
+		reset = ""
+	}
+	if state.Approval.Records {
+		reset = []interface{}{}
 	}
 
-	// Write any existing status back to dxr
-	if len(xrStatus) > 0 {
-		if err := dxr.Resource.SetValue("status", xrStatus); err != nil {
-			f.log.Info("Error setting status in Desired XR", "error", err)
+	currentHash := state.NewHash
+	if state.HashKey != nil {
+		sealed, err := sealHash(state.NewHash, state.HashKey)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot seal approved hash"))
 			return err
 		}
+		currentHash = sealed
 	}
 
-	// Save the desired XR in the response
-	if err := response.SetDesiredCompositeResource(rsp, dxr); err != nil {
-		response.Fatal(rsp, errors.Wrapf(err, "cannot set desired composite resource in %T", rsp))
+	settings, err := f.encodeHashSettings(g, state)
+	if err != nil {
+		response.Fatal(rsp, err)
 		return err
 	}
 
-	f.log.Info("Successfully propagated Desired XR")
-	return nil
-}
+	values := map[string]interface{}{
+		*g.CurrentHashField:  currentHash,
+		*g.PendingHashField:  "",
+		*g.HashSettingsField: settings,
+	}
 
-// preserveContext ensures the context is preserved in the response
-func (f *Function) preserveContext(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse) {
-	// Get the existing context from the request
-	existingContext := req.GetContext()
-	if existingContext != nil {
-		// Copy the existing context to the response
-		rsp.Context = existingContext
-		f.log.Info("Preserved existing context in response")
+	// An approval given for a later change must survive a change that was
+	// approved on its own. Approvals outside status can't be reset, so an
+	// approval of true is recorded as used instead. Approval objects hold
+	// hashes, which can't approve another change anyway.
+	switch {
+	case state.AutoApproval != "", g.ApprovalObjects != nil:
+	case gateApprovalSource(g) == approvalSourceStatus:
+		values[*g.ApprovalField] = reset
+	case state.Approval.Approved && state.Approval.Hash == "" && !state.Approval.Records:
+		values[*g.ConsumedApprovalField] = state.NewHash
 	}
-}
 
-// ParseNestedKey enables the bracket and dot notation to key reference
-func ParseNestedKey(key string) ([]string, error) {
-	var parts []string
-	// Regular expression to extract keys, supporting both dot and bracket notation
-	// For simplicity in this implementation, we'll use a simpler approach
-	for _, part := range strings.Split(key, ".") {
-		if part != "" {
-			parts = append(parts, part)
+	if state.FieldHashes != nil {
+		fieldHashes := make(map[string]interface{}, len(state.FieldHashes))
+		for path, hash := range state.FieldHashes {
+			fieldHashes[path] = hash
 		}
+		values[*g.FieldHashesField] = fieldHashes
 	}
 
-	if len(parts) == 0 {
-		return nil, errors.New("invalid key")
+	if state.ResourceHashes != nil {
+		hashes := state.ResourceHashes
+		if state.HashKey != nil {
+			hashes, err = sealResourceHashes(hashes, state.NewHash, state.HashKey)
+			if err != nil {
+				response.Fatal(rsp, err)
+				return err
+			}
+		}
+
+		resourceHashes := make(map[string]interface{}, len(hashes))
+		for name, hash := range hashes {
+			resourceHashes[name] = hash
+		}
+		values[*g.ResourceHashesField] = resourceHashes
 	}
-	return parts, nil
-}
 
-// GetNestedValue retrieves a nested value from a map using dot notation keys.
-func GetNestedValue(data map[string]interface{}, key string) (interface{}, bool, error) {
-	parts, err := ParseNestedKey(key)
-	if err != nil {
-		return nil, false, err
+	if *g.Enforcement == v1beta1.EnforcementPause {
+		// Paused resources were unpaused when the change was approved
+		values[*g.PausedResourcesField] = []interface{}{}
 	}
 
-	currentValue := interface{}(data)
-	for _, k := range parts {
-		// Check if the current value is a map
-		if nestedMap, ok := currentValue.(map[string]interface{}); ok {
-			// Get the next value in the nested map
-			if nextValue, exists := nestedMap[k]; exists {
-				currentValue = nextValue
-			} else {
-				return nil, false, nil
-			}
-		} else {
-			return nil, false, nil
+	if holdsResources(g) {
+		encoded, err := encodeApprovedResources(state.DesiredResources, state.NewHash, state.HashKey)
+		if err != nil {
+			response.Fatal(rsp, err)
+			return err
 		}
-	}
 
-	return currentValue, true, nil
-}
+		// Held resources keep their observed state if the approved rendering
+		// is too large to store
+		if len(encoded) > *g.MaxApprovedResourcesSize {
+			f.log.Info("Approved resources are too large to store", "gate", g.Name, "size", len(encoded), "maxSize", *g.MaxApprovedResourcesSize)
+			encoded = ""
+		}
+		values[*g.ApprovedResourcesField] = encoded
+	}
 
-// SetNestedValue sets a value to a nested key from a map using dot notation keys.
-func SetNestedValue(root map[string]interface{}, key string, value interface{}) error {
-	parts, err := ParseNestedKey(key)
-	if err != nil {
-		return err
+	if g.PatchField != nil {
+		// Nothing is pending any more
+		values[*g.PatchField] = map[string]interface{}{}
 	}
 
-	current := root
-	for i, part := range parts {
-		if i == len(parts)-1 {
-			// Set the value at the final key
-			current[part] = value
-			return nil
+	if *g.MaxSnapshotSize > 0 {
+		// Tolerances are measured from the last manual approval
+		s := newSnapshot(state.NewHash, state.Fields)
+		if !state.Approval.Approved {
+			s.Baseline = toleranceBaseline(state.ApprovedSnapshot, state.Changes)
 		}
-
-		// Traverse into nested maps or create them if they don't exist
-		if next, exists := current[part]; exists {
-			if nextMap, ok := next.(map[string]interface{}); ok {
-				current = nextMap
-			} else {
-				return errors.Errorf("key %q exists but is not a map", part)
+		if state.HashKey != nil {
+			if err := sealSnapshot(s, state.HashKey); err != nil {
+				response.Fatal(rsp, err)
+				return err
 			}
-		} else {
-			// Create a new map if the path doesn't exist
-			newMap := make(map[string]interface{})
-			current[part] = newMap
-			current = newMap
 		}
-	}
 
-	return nil
-}
+		encoded, err := encodeSnapshot(s)
+		if err != nil {
+			response.Fatal(rsp, err)
+			return err
+		}
 
-// extractDataToHash extracts the data to hash from either the desired state or specified field
-func (f *Function) extractDataToHash(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) (interface{}, error) {
-	dxr, err := request.GetDesiredCompositeResource(req)
-	if err != nil {
-		response.Fatal(rsp, errors.Wrap(err, "cannot get desired composite resource"))
-		return nil, err
+		// A snapshot that is too large is dropped, rather than kept around
+		// for a hash it no longer matches
+		if len(encoded) > *g.MaxSnapshotSize {
+			f.log.Info("Approved data is too large to keep a snapshot", "gate", g.Name, "size", len(encoded), "maxSize", *g.MaxSnapshotSize)
+			encoded = ""
+		}
+		values[*g.SnapshotField] = encoded
 	}
 
-	// Always extract data from the specific field defined in DataField
-	// Parse the DataField to get section and field (e.g. "spec.resources" -> "spec", "resources")
-	parts := strings.SplitN(in.DataField, ".", 2)
-	if len(parts) != 2 {
-		response.Fatal(rsp, errors.Errorf("invalid DataField format: %s, expected section.field (e.g. spec.resources)", in.DataField))
-		return nil, errors.New("invalid DataField format")
+	if state.IgnoredHashes != nil {
+		ignoredHashes := make(map[string]interface{}, len(state.IgnoredHashes))
+		for path, hash := range state.IgnoredHashes {
+			ignoredHashes[path] = hash
+		}
+		values[*g.IgnoredHashesField] = ignoredHashes
 	}
 
-	section, field := parts[0], parts[1]
-	f.log.Debug("Calculating hash from field", "dataField", in.DataField, "section", section, "field", field)
+	return f.setStatusFields(rsp, values)
+}
 
-	var sectionData map[string]interface{}
-	if err := dxr.Resource.GetValueInto(section, &sectionData); err != nil {
-		response.Fatal(rsp, errors.Wrapf(err, "cannot get %s from desired XR", section))
-		return nil, err
+// encodeHashSettings returns the gate's hash settings as they are recorded in
+// the XR status, sealed to the new hash if the gate has a hash key
+func (f *Function) encodeHashSettings(g *v1beta1.Gate, state *approvalState) (map[string]interface{}, error) {
+	recorded := recordedHashSettings{hashSettings: gateHashSettings(g)}
+	if state.HashKey != nil {
+		mac, err := macHashSettings(recorded.hashSettings, state.NewHash, state.HashKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot seal hash settings")
+		}
+		recorded.MAC = mac
 	}
 
-	data, exists, err := GetNestedValue(sectionData, field)
+	data, err := json.Marshal(recorded)
 	if err != nil {
-		response.Fatal(rsp, errors.Wrapf(err, "error accessing field %s", field))
-		return nil, err
+		return nil, errors.Wrap(err, "cannot encode hash settings")
 	}
 
-	if !exists {
-		response.Fatal(rsp, errors.Errorf("field %s.%s not found in resource", section, field))
-		return nil, errors.New("field not found")
+	encoded := map[string]interface{}{}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, errors.Wrap(err, "cannot encode hash settings")
 	}
-
-	return data, nil
+	return encoded, nil
 }
 
-// calculateHash calculates hash for the given data using SHA256
-func (f *Function) calculateHash(data interface{}, _ *v1beta1.Input) string {
-	// Create a JSON representation of the data
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		f.log.Debug("Error marshaling data to JSON", "error", err)
-		return ""
-	}
-
-	// Calculate SHA256 hash
-	h := sha256.New()
-	h.Write(jsonData)
-	return hex.EncodeToString(h.Sum(nil))
+// savePendingHash publishes the hash that is waiting for approval
+func (f *Function) savePendingHash(g *v1beta1.Gate, hash string, rsp *fnv1.RunFunctionResponse) error {
+	return f.setStatusFields(rsp, map[string]interface{}{
+		*g.PendingHashField: hash,
+	})
 }
 
-// getCurrentHash retrieves the currently approved hash
-func (f *Function) getCurrentHash(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) (string, error) {
-	xrStatus, _, err := f.getXRAndStatus(req)
-	if err != nil {
-		response.Fatal(rsp, err)
-		return "", err
+// withdrawStaleApproval resets an approval of true that was given for another
+// pending hash, or while none was pending, so that it can't approve the hash
+// published in its place. Approvals outside status can't be reset, so the
+// hash they were given for, or else the published hash, is recorded as
+// consumed instead.
+func (f *Function) withdrawStaleApproval(g *v1beta1.Gate, approval approvalStatus, newHash string, rsp *fnv1.RunFunctionResponse) error {
+	f.log.Info("Withdrawing stale approval", "gate", g.Name, "pendingHash", approval.Pending)
+	if gateApprovalSource(g) != approvalSourceStatus {
+		consumed := approval.Pending
+		if consumed == "" {
+			consumed = newHash
+		}
+		return f.setStatusFields(rsp, map[string]interface{}{
+			*g.ConsumedApprovalField: consumed,
+		})
 	}
 
-	// Remove status. prefix if present
-	hashField := strings.TrimPrefix(*in.CurrentHashField, "status.")
-
-	// Get the current hash from status
-	value, exists, err := GetNestedValue(xrStatus, hashField)
-	if err != nil {
-		response.Fatal(rsp, errors.Wrapf(err, "error accessing current hash field %s", hashField))
-		return "", err
-	}
+	return f.setStatusFields(rsp, map[string]interface{}{
+		*g.ApprovalField: false,
+	})
+}
 
-	if !exists {
-		// Not an error, just means this is the first time we're seeing this resource
-		return "", nil
-	}
+// savePendingPatch publishes the pending change as patches that turn the
+// approved data into the pending data, so tools can render the change without
+// hashing and extracting the data themselves
+func (f *Function) savePendingPatch(g *v1beta1.Gate, state *approvalState, rsp *fnv1.RunFunctionResponse) error {
+	pending := map[string]interface{}{"hash": state.NewHash}
+	if state.ApprovedSnapshot != nil {
+		pending["jsonPatch"] = jsonPatch(state.Changes)
+		if patch, ok := mergePatch(state.ApprovedSnapshot, newSnapshot(state.NewHash, state.Fields)); ok {
+			pending["mergePatch"] = patch
+		}
 
-	strValue, ok := value.(string)
-	if !ok {
-		response.Fatal(rsp, errors.Errorf("current hash field %s is not a string", hashField))
-		return "", errors.New("current hash field is not a string")
+		// The patches are computed on the data as it is hashed. Tell tools
+		// when that differs from the XR, so they don't apply them to it.
+		if gateHashSettings(g).reshapes() {
+			pending["normalized"] = true
+		}
 	}
 
-	return strValue, nil
+	return f.setStatusFields(rsp, map[string]interface{}{
+		*g.PatchField: pending,
+	})
 }
 
-// saveCurrentHash updates the current hash with the new hash after approval
-func (f *Function) saveCurrentHash(req *fnv1.RunFunctionRequest, in *v1beta1.Input, hash string, rsp *fnv1.RunFunctionResponse) error {
-	// For the status update, we need to access the composite resource in the desired state
-	// that we'll be passing through later
-	dxr, err := request.GetDesiredCompositeResource(req)
+// setStatusFields writes the supplied values into the status of the desired
+// XR that is being accumulated in the response
+func (f *Function) setStatusFields(rsp *fnv1.RunFunctionResponse, values map[string]interface{}) error {
+	// Work on the desired XR in the response so we don't drop anything that
+	// was written to it earlier in this run
+	dxr, err := request.GetDesiredCompositeResource(&fnv1.RunFunctionRequest{Desired: rsp.GetDesired()})
 	if err != nil {
 		response.Fatal(rsp, errors.Wrap(err, "cannot get desired composite resource"))
 		return err
@@ -476,20 +1854,14 @@ func (f *Function) saveCurrentHash(req *fnv1.RunFunctionRequest, in *v1beta1.Inp
 		xrStatus = make(map[string]interface{})
 	}
 
-	// Remove status. prefix if present
-	hashField := strings.TrimPrefix(*in.CurrentHashField, "status.")
-
-	// Set the current hash in status
-	if err := SetNestedValue(xrStatus, hashField, hash); err != nil {
-		response.Fatal(rsp, errors.Wrapf(err, "cannot set current hash field %s", hashField))
-		return err
-	}
+	for field, value := range values {
+		// Resolve the field relative to status
+		statusField := trimStatusPrefix(field)
 
-	// Reset approval field since it's been processed
-	approvalField := strings.TrimPrefix(*in.ApprovalField, "status.")
-	if err := SetNestedValue(xrStatus, approvalField, false); err != nil {
-		f.log.Debug("Cannot reset approval field", "error", err)
-		// Not a fatal error
+		if err := SetNestedValue(xrStatus, statusField, value); err != nil {
+			response.Fatal(rsp, errors.Wrapf(err, "cannot set status field %s", statusField))
+			return err
+		}
 	}
 
 	// Update the status on the desired resource
@@ -507,34 +1879,247 @@ func (f *Function) saveCurrentHash(req *fnv1.RunFunctionRequest, in *v1beta1.Inp
 	return nil
 }
 
-// checkApprovalStatus checks if the current changes are approved
-func (f *Function) checkApprovalStatus(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) (bool, error) {
-	xrStatus, _, err := f.getXRAndStatus(req)
+// defaultMaxSnapshotSize is the largest snapshot of approved data stored by
+// default, in bytes after encoding
+const defaultMaxSnapshotSize = 32768
+
+// minApprovalHashPrefix is the shortest hash prefix accepted as an approval
+const minApprovalHashPrefix = 16
+
+// approvalStatus describes the approval decision recorded on the XR
+type approvalStatus struct {
+	// Approved is true if the approval covers the pending change
+	Approved bool
+
+	// Stale is true if an approval exists but was given for another change
+	Stale bool
+
+	// Hash is the hash named by the approval, if it named one
+	Hash string
+
+	// Records is true if the approval is a list of approver records
+	Records bool
+
+	// Approvers are the distinct approvers of the pending change, if the
+	// approval is a list of approver records
+	Approvers []string
+
+	// ApprovedHashes are the hashes the approver records approve, if none of
+	// them approve the pending change
+	ApprovedHashes []string
+
+	// Progress describes how much of the quorum has been collected, if the
+	// gate requires one
+	Progress string
+
+	// Rejected explains why approver records were rejected by the approver
+	// directory
+	Rejected []string
+
+	// Consumed is the hash an approval of true outside status was already
+	// used for
+	Consumed string
+
+	// Pending is the pending hash a stale approval of true was given for. It
+	// is empty if no hash was pending when the approval was given.
+	Pending string
+
+	// Withdraw is true if the approval is a stale approval of true that must
+	// be withdrawn before the pending hash is published
+	Withdraw bool
+}
+
+// checkApprovalStatus checks if the current changes are approved. An approval
+// is only accepted if it is bound to the hash of the pending change, so that
+// changes made after an approver looked at them are not approved implicitly.
+func (f *Function) checkApprovalStatus(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse, currentHash, newHash string) (approvalStatus, error) {
+	// Approver records are only accepted from approvers in the directory
+	var dir approverDirectory
+	if g.ApproverDirectory != nil {
+		var err error
+		dir, err = f.getApproverDirectory(req, g, rsp)
+		if err != nil {
+			return approvalStatus{}, err
+		}
+	}
+
+	// Approvals of true and hash prefixes only apply to the hash we published
+	// as pending
+	pendingHash, published, err := f.getStatusString(req, *g.PendingHashField, rsp)
 	if err != nil {
-		response.Fatal(rsp, err)
-		return false, err
+		return approvalStatus{}, err
 	}
 
-	// Remove status. prefix if present
-	approvalField := strings.TrimPrefix(*in.ApprovalField, "status.")
+	// Approval objects hold approver records. Until Crossplane fetched them
+	// there are none.
+	if g.ApprovalObjects != nil {
+		records, err := f.getApprovalObjects(req, g, rsp)
+		if err != nil {
+			return approvalStatus{}, err
+		}
+		return f.checkApproverRecords(req, g, rsp, records, dir, currentHash, newHash, pendingHash)
+	}
 
 	// Get the approval status
-	value, exists, err := GetNestedValue(xrStatus, approvalField)
+	value, exists, err := f.getApprovalValue(req, g, rsp)
 	if err != nil {
-		response.Fatal(rsp, errors.Wrapf(err, "error accessing approval field %s", approvalField))
-		return false, err
+		return approvalStatus{}, err
+	}
+
+	// We can't reset an approval outside status, so an approval of true is
+	// only used once
+	if gateApprovalSource(g) != approvalSourceStatus {
+		consumed, err := f.checkConsumedApproval(req, g, rsp, value)
+		if err != nil {
+			return approvalStatus{}, err
+		}
+		// An approval is consumed by the change it approved, which is then
+		// the current hash. A stale approval is withdrawn by recording the
+		// pending hash it was given for, or the hash published in its place
+		// if none was pending.
+		switch {
+		case consumed == "":
+		case sameHash(consumed, currentHash):
+			return approvalStatus{Stale: true, Consumed: consumed}, nil
+		case sameHash(consumed, newHash):
+			return approvalStatus{Stale: true}, nil
+		default:
+			return approvalStatus{Stale: true, Pending: consumed}, nil
+		}
 	}
 
 	if !exists {
 		// Not explicitly approved
-		return false, nil
+		return approvalStatus{}, nil
 	}
 
-	boolValue, ok := value.(bool)
-	if !ok {
-		response.Fatal(rsp, errors.Errorf("approval field %s is not a boolean", approvalField))
-		return false, errors.New("approval field is not a boolean")
+	// A quorum, a directory or signatures can only be satisfied by approver
+	// records
+	if records, ok := value.([]interface{}); ok || requiresRecords(g) {
+		return f.checkApproverRecords(req, g, rsp, records, dir, currentHash, newHash, pendingHash)
+	}
+
+	switch v := value.(type) {
+	case bool:
+		if !v {
+			return approvalStatus{}, nil
+		}
+
+		if sameHash(pendingHash, newHash) {
+			return approvalStatus{Approved: true}, nil
+		}
+
+		// XRs approved in status before pending hashes were published have
+		// no pending hash field at all. Accept their approval as before.
+		// Other sources are newer than pending hashes, so their approval
+		// can't predate them.
+		if !published && gateApprovalSource(g) == approvalSourceStatus {
+			return approvalStatus{Approved: true}, nil
+		}
+
+		// An approval given for another pending hash, or while none was
+		// pending, must not approve the hash published in its place
+		return approvalStatus{Stale: true, Pending: pendingHash, Withdraw: true}, nil
+	case string:
+		if v == "" {
+			return approvalStatus{}, nil
+		}
+
+		if matchesHash(v, newHash, currentHash, pendingHash) {
+			return approvalStatus{Approved: true, Hash: v}, nil
+		}
+
+		return approvalStatus{Stale: true, Hash: v}, nil
+	default:
+		response.Fatal(rsp, errors.Errorf("approval field %s is not a boolean or a hash", *g.ApprovalField))
+		return approvalStatus{}, errors.New("approval field is not a boolean or a hash")
+	}
+}
+
+// requiresRecords returns true if the gate only accepts approver records,
+// since a boolean or a hash doesn't identify an approver
+func requiresRecords(g *v1beta1.Gate) bool {
+	return g.Quorum != nil || g.ApproverDirectory != nil || g.ApprovalSignatures != nil
+}
+
+// checkApproverRecords checks if the approver records in the approval field
+// approve the current changes. Without a quorum a single approver is enough.
+// If the gate has an approver directory, records are only counted once the
+// directory is fetched, and only if it lists their approver. If the gate
+// requires signatures, records of the pending change must be signed.
+func (f *Function) checkApproverRecords(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse, values []interface{}, dir approverDirectory, currentHash, newHash, pendingHash string) (approvalStatus, error) {
+	records, err := parseApproverRecords(values)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrapf(err, "invalid approval field %s", *g.ApprovalField))
+		return approvalStatus{}, err
+	}
+
+	var rejected []string
+	if g.ApproverDirectory != nil {
+		if dir == nil {
+			records = nil
+		}
+		records, rejected = verifyApprovers(records, dir)
+	}
+
+	if g.ApprovalSignatures != nil && len(records) > 0 {
+		keys, err := f.getSignatureKeys(req, g, rsp)
+		if err != nil {
+			return approvalStatus{}, err
+		}
+
+		oxr, err := request.GetObservedCompositeResource(req)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot get observed composite resource"))
+			return approvalStatus{}, err
+		}
+
+		var invalid []string
+		records, invalid = verifySignatures(records, keys, approvalSigners(g.ApprovalSignatures), string(oxr.Resource.GetUID()), newHash, currentHash, pendingHash, time.Now())
+		rejected = append(rejected, invalid...)
+	}
+
+	quorum := &defaultQuorum
+	if g.Quorum != nil {
+		quorum = g.Quorum
+	}
+
+	p := evaluateQuorum(records, quorum, newHash, currentHash, pendingHash)
+	status := approvalStatus{
+		Approved:  p.Met,
+		Stale:     len(records) > 0 && len(p.Approvers) == 0,
+		Records:   true,
+		Approvers: p.Approvers,
+		Rejected:  rejected,
+	}
+	if status.Stale {
+		for _, r := range records {
+			if !slices.Contains(status.ApprovedHashes, r.Hash) {
+				status.ApprovedHashes = append(status.ApprovedHashes, r.Hash)
+			}
+		}
+		slices.Sort(status.ApprovedHashes)
+	}
+	if g.Quorum != nil {
+		status.Progress = p.Progress
+	}
+	return status, nil
+}
+
+// matchesHash reports whether an approval value names the supplied hash,
+// either in full, by its digest, or by a prefix of its digest that does not
+// also match the other hash. A prefix only names the hash if it is the
+// published pending hash, so that a change can't be crafted to match a prefix
+// that was approved for another one.
+func matchesHash(value, hash, other, pending string) bool {
+	digest := parseHash(hash).Digest
+	if sameHash(value, hash) || value == digest {
+		return true
+	}
+
+	if len(value) < minApprovalHashPrefix || !strings.HasPrefix(digest, value) || !sameHash(pending, hash) {
+		return false
 	}
 
-	return boolValue, nil
+	return sameHash(other, hash) || !strings.HasPrefix(parseHash(other).Digest, value)
 }
@@ -2,8 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/crossplane/function-sdk-go/logging"
 	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
@@ -12,6 +20,9 @@ import (
 
 const (
 	approvalRequiredCondition = "ApprovalRequired"
+
+	// hashPrefix is the prefix of hashes stored by the default algorithm
+	hashPrefix = "sha256:v1:"
 )
 
 func TestFunction_MalformedInput(t *testing.T) {
@@ -863,3 +874,2928 @@ func TestFunction_ApprovedWithHashChanges(t *testing.T) {
 		}
 	}
 }
+
+func TestFunction_HashBoundApproval(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	const (
+		oldHash     = "e02c6d35c585a43c62dc2ae14a5385b8a86168b36be7a0d985c0c09afca4ffbe"
+		pendingHash = "a07bdeee84158b7c1b565b1f65ead2f1ff88d0d111b622907e953f19174a1cfb"
+	)
+
+	xr := `{
+		"apiVersion": "example.org/v1",
+		"kind": "XR",
+		"metadata": {
+			"name": "test-xr"
+		},
+		"spec": {
+			"resources": {
+				"test": "updated-data"
+			}
+		},
+		"status": {
+			"approved": "a07bdeee84158b7c",
+			"currentHash": "` + oldHash + `",
+			"pendingHash": "` + pendingHash + `"
+		}
+	}`
+
+	req := &fnv1.RunFunctionRequest{
+		Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+		Input: resource.MustStructJSON(`{
+			"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+			"kind": "Input",
+			"dataField": "spec.resources"
+		}`),
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+		Desired: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+	}
+
+	rsp, err := f.RunFunction(context.Background(), req)
+
+	if err != nil {
+		t.Errorf("expected no error but got: %v", err)
+	}
+
+	// An approval naming a prefix of the pending hash should be accepted
+	if len(rsp.GetResults()) > 0 {
+		t.Errorf("expected no results but got: %v", rsp.GetResults())
+	}
+
+	status := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	if status["currentHash"] != hashPrefix+pendingHash {
+		t.Errorf("expected currentHash to be %s but got: %v", hashPrefix+pendingHash, status["currentHash"])
+	}
+	if status["pendingHash"] != "" {
+		t.Errorf("expected pendingHash to be cleared but got: %v", status["pendingHash"])
+	}
+	if status["approved"] != "" {
+		t.Errorf("expected approval to be cleared but got: %v", status["approved"])
+	}
+}
+
+func TestFunction_StaleApprovalRejected(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	const (
+		oldHash     = "e02c6d35c585a43c62dc2ae14a5385b8a86168b36be7a0d985c0c09afca4ffbe"
+		newHash     = "a07bdeee84158b7c1b565b1f65ead2f1ff88d0d111b622907e953f19174a1cfb"
+		reviewedFor = "559b7f636dcd75c3dfa6449f7aaa060fd8a52fc7d70f74792feb04930fa2c400"
+	)
+
+	cases := map[string]string{
+		// The approver approved the published pending hash, but the spec
+		// changed again before the function ran.
+		"BooleanForOldPendingHash": `"approved": true, "pendingHash": "` + reviewedFor + `"`,
+		// The approver named a hash that is not the one being applied.
+		"HashForAnotherChange": `"approved": "` + reviewedFor + `", "pendingHash": "` + reviewedFor + `"`,
+		// The approver approved while no change was pending.
+		"BooleanWhileNothingPending": `"approved": true, "pendingHash": ""`,
+		// A prefix only approves the published pending hash, so a change
+		// can't be crafted to match a prefix approved for another one.
+		"PrefixWhileNothingPending": `"approved": "a07bdeee84158b7c", "pendingHash": ""`,
+		"PrefixOfUnpublishedHash":   `"approved": "a07bdeee84158b7c", "pendingHash": "` + reviewedFor + `"`,
+	}
+
+	for name, status := range cases {
+		t.Run(name, func(t *testing.T) {
+			xr := `{
+				"apiVersion": "example.org/v1",
+				"kind": "XR",
+				"metadata": {
+					"name": "test-xr"
+				},
+				"spec": {
+					"resources": {
+						"test": "updated-data"
+					}
+				},
+				"status": {
+					"currentHash": "` + oldHash + `",
+					` + status + `
+				}
+			}`
+
+			req := &fnv1.RunFunctionRequest{
+				Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+				Input: resource.MustStructJSON(`{
+					"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+					"kind": "Input",
+					"dataField": "spec.resources"
+				}`),
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				},
+				Desired: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				},
+			}
+
+			rsp, err := f.RunFunction(context.Background(), req)
+
+			if err != nil {
+				t.Errorf("expected no error but got: %v", err)
+			}
+
+			hasFatalResult := false
+			for _, result := range rsp.GetResults() {
+				if result.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+					hasFatalResult = true
+				}
+			}
+
+			if !hasFatalResult {
+				t.Error("expected stale approval to halt the pipeline but it didn't")
+			}
+
+			hasStaleApproval := false
+			for _, cond := range rsp.GetConditions() {
+				if cond.GetType() == approvalRequiredCondition && cond.GetReason() == "StaleApproval" {
+					hasStaleApproval = true
+				}
+			}
+
+			if !hasStaleApproval {
+				t.Errorf("expected ApprovalRequired condition with StaleApproval reason but got: %v", rsp.GetConditions())
+			}
+
+			// The hash we are now waiting on should be published
+			status := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+			if status["pendingHash"] != hashPrefix+newHash {
+				t.Errorf("expected pendingHash to be %s but got: %v", hashPrefix+newHash, status["pendingHash"])
+			}
+			if status["currentHash"] != oldHash {
+				t.Errorf("expected currentHash to remain %s but got: %v", oldHash, status["currentHash"])
+			}
+		})
+	}
+}
+
+func TestFunction_StaleBooleanApprovalWithdrawn(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	const (
+		oldHash     = "e02c6d35c585a43c62dc2ae14a5385b8a86168b36be7a0d985c0c09afca4ffbe"
+		reviewedFor = "559b7f636dcd75c3dfa6449f7aaa060fd8a52fc7d70f74792feb04930fa2c400"
+	)
+
+	input := resource.MustStructJSON(`{
+		"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+		"kind": "Input",
+		"dataField": "spec.resources"
+	}`)
+
+	cases := map[string]string{
+		// The approval was given for a pending hash that was replaced
+		"ForOldPendingHash": reviewedFor,
+		// The approval was set, or left over, after the last change was
+		// approved and before the next one arrived
+		"WhileNothingPending": "",
+	}
+
+	for name, pendingHash := range cases {
+		t.Run(name, func(t *testing.T) {
+			xr := resource.MustStructJSON(`{
+				"apiVersion": "example.org/v1",
+				"kind": "XR",
+				"metadata": {
+					"name": "test-xr"
+				},
+				"spec": {
+					"resources": {
+						"test": "updated-data"
+					}
+				},
+				"status": {
+					"currentHash": "` + oldHash + `",
+					"approved": true,
+					"pendingHash": "` + pendingHash + `"
+				}
+			}`)
+
+			// The first run rejects the approval and publishes the new pending
+			// hash
+			rsp, err := f.RunFunction(context.Background(), &fnv1.RunFunctionRequest{
+				Input:    input,
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: xr}},
+				Desired:  &fnv1.State{Composite: &fnv1.Resource{Resource: xr}},
+			})
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			status := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+			if status["approved"] != false {
+				t.Errorf("expected stale approval to be reset but got: %v", status["approved"])
+			}
+
+			// The second run sees the status written by the first. The
+			// pending hash now matches, but nobody approved it.
+			xr = rsp.GetDesired().GetComposite().GetResource()
+			rsp, err = f.RunFunction(context.Background(), &fnv1.RunFunctionRequest{
+				Input:    input,
+				Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: xr}},
+				Desired:  &fnv1.State{Composite: &fnv1.Resource{Resource: xr}},
+			})
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			hasFatalResult := false
+			for _, result := range rsp.GetResults() {
+				if result.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+					hasFatalResult = true
+				}
+			}
+			if !hasFatalResult {
+				t.Error("expected the republished hash to still require approval")
+			}
+
+			status = rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+			if status["currentHash"] != oldHash {
+				t.Errorf("expected currentHash to remain %s but got: %v", oldHash, status["currentHash"])
+			}
+		})
+	}
+}
+
+func TestFunction_MultipleDataFields(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	xr := `{
+		"apiVersion": "example.org/v1",
+		"kind": "XR",
+		"metadata": {
+			"name": "test-xr"
+		},
+		"spec": {
+			"parameters": {
+				"size": "large"
+			},
+			"resources": {
+				"test": "data"
+			}
+		},
+		"status": {
+			"currentHash": "e02c6d35c585a43c62dc2ae14a5385b8a86168b36be7a0d985c0c09afca4ffbe",
+			"fieldHashes": {
+				"spec.parameters": "0000000000000000000000000000000000000000000000000000000000000000",
+				"spec.resources": "e1d7c49f3a04e1ec1a5b150ec68041c903cd75fda52aa1239fd586439ef1154b"
+			}
+		}
+	}`
+
+	req := &fnv1.RunFunctionRequest{
+		Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+		Input: resource.MustStructJSON(`{
+			"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+			"kind": "Input",
+			"dataFields": ["spec.parameters", "spec.resources", "spec.networking"],
+			"missingFieldPolicy": "Empty"
+		}`),
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+		Desired: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+	}
+
+	rsp, err := f.RunFunction(context.Background(), req)
+
+	if err != nil {
+		t.Errorf("expected no error but got: %v", err)
+	}
+
+	hasApprovalRequired := false
+	for _, cond := range rsp.GetConditions() {
+		if cond.GetType() == approvalRequiredCondition {
+			hasApprovalRequired = true
+			message := cond.GetMessage()
+			for _, want := range []string{
+				"- spec.parameters: changed",
+				"- spec.resources: unchanged",
+				"- spec.networking: added (missing, treated as empty)",
+			} {
+				if !strings.Contains(message, want) {
+					t.Errorf("expected condition message to contain %q but got: %v", want, message)
+				}
+			}
+		}
+	}
+
+	if !hasApprovalRequired {
+		t.Error("expected to find ApprovalRequired condition but didn't")
+	}
+}
+
+func TestFunction_MissingDataFieldIsFatal(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	xr := `{
+		"apiVersion": "example.org/v1",
+		"kind": "XR",
+		"metadata": {
+			"name": "test-xr"
+		},
+		"spec": {
+			"parameters": {
+				"size": "large"
+			}
+		}
+	}`
+
+	req := &fnv1.RunFunctionRequest{
+		Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+		Input: resource.MustStructJSON(`{
+			"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+			"kind": "Input",
+			"dataFields": ["spec.parameters", "spec.networking"]
+		}`),
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+		Desired: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+	}
+
+	rsp, err := f.RunFunction(context.Background(), req)
+
+	if err != nil {
+		t.Errorf("expected no error but got: %v", err)
+	}
+
+	if len(rsp.GetResults()) == 0 {
+		t.Fatal("expected fatal result but got none")
+	}
+
+	result := rsp.GetResults()[0]
+	if result.GetSeverity() != fnv1.Severity_SEVERITY_FATAL {
+		t.Errorf("expected SEVERITY_FATAL but got: %v", result.GetSeverity())
+	}
+	if !strings.Contains(result.GetMessage(), "spec.networking not found") {
+		t.Errorf("expected fatal message to name the missing field but got: %v", result.GetMessage())
+	}
+}
+
+func TestFunction_MultipleGates(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	// Hash of {"test":"data"}
+	const securityHash = "e1d7c49f3a04e1ec1a5b150ec68041c903cd75fda52aa1239fd586439ef1154b"
+
+	xr := `{
+		"apiVersion": "example.org/v1",
+		"kind": "XR",
+		"metadata": {
+			"name": "test-xr"
+		},
+		"spec": {
+			"resources": {
+				"test": "data"
+			},
+			"parameters": {
+				"instances": 5
+			}
+		},
+		"status": {
+			"gates": {
+				"security": {
+					"approved": "` + securityHash + `"
+				}
+			}
+		}
+	}`
+
+	req := &fnv1.RunFunctionRequest{
+		Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+		Input: resource.MustStructJSON(`{
+			"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+			"kind": "Input",
+			"gates": [
+				{
+					"name": "security",
+					"dataField": "spec.resources"
+				},
+				{
+					"name": "cost",
+					"dataField": "spec.parameters",
+					"approvalMessage": "Cost changes require FinOps approval."
+				}
+			]
+		}`),
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+		Desired: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+	}
+
+	rsp, err := f.RunFunction(context.Background(), req)
+
+	if err != nil {
+		t.Errorf("expected no error but got: %v", err)
+	}
+
+	// The cost gate is not approved, so the pipeline must halt
+	hasFatalResult := false
+	for _, result := range rsp.GetResults() {
+		if result.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			hasFatalResult = true
+			message := result.GetMessage()
+			if !strings.Contains(message, "Gate cost: Cost changes require FinOps approval.") {
+				t.Errorf("expected fatal message to name the cost gate but got: %v", message)
+			}
+			if strings.Contains(message, "Gate security") {
+				t.Errorf("expected fatal message not to name the approved security gate but got: %v", message)
+			}
+		}
+	}
+
+	if !hasFatalResult {
+		t.Error("expected to find fatal result but didn't")
+	}
+
+	conditions := map[string]*fnv1.Condition{}
+	for _, cond := range rsp.GetConditions() {
+		conditions[cond.GetType()] = cond
+	}
+
+	if cond, ok := conditions["SecurityApprovalRequired"]; !ok || cond.GetStatus() != fnv1.Status_STATUS_CONDITION_TRUE {
+		t.Errorf("expected SecurityApprovalRequired to be true but got: %v", cond)
+	}
+	if cond, ok := conditions["CostApprovalRequired"]; !ok || cond.GetStatus() != fnv1.Status_STATUS_CONDITION_FALSE {
+		t.Errorf("expected CostApprovalRequired to be false but got: %v", cond)
+	}
+	if _, ok := conditions["FunctionSuccess"]; ok {
+		t.Error("expected no FunctionSuccess condition while a gate is waiting for approval")
+	}
+
+	// Each gate keeps its state in its own status fields
+	gates := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})["gates"].(map[string]interface{})
+	security := gates["security"].(map[string]interface{})
+	if security["currentHash"] != hashPrefix+securityHash {
+		t.Errorf("expected security gate currentHash to be %s but got: %v", hashPrefix+securityHash, security["currentHash"])
+	}
+	cost := gates["cost"].(map[string]interface{})
+	if cost["pendingHash"] == "" || cost["pendingHash"] == nil {
+		t.Errorf("expected cost gate to publish a pending hash but got: %v", cost)
+	}
+}
+
+func TestFunction_GatesSharingStatusFields(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	req := &fnv1.RunFunctionRequest{
+		Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+		Input: resource.MustStructJSON(`{
+			"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+			"kind": "Input",
+			"gates": [
+				{
+					"name": "security",
+					"dataField": "spec.resources",
+					"approvalField": "status.approved"
+				},
+				{
+					"name": "cost",
+					"dataField": "spec.parameters",
+					"approvalField": "status.approved"
+				}
+			]
+		}`),
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{
+				Resource: resource.MustStructJSON(`{
+					"apiVersion": "example.org/v1",
+					"kind": "XR",
+					"metadata": {
+						"name": "test-xr"
+					}
+				}`),
+			},
+		},
+	}
+
+	rsp, err := f.RunFunction(context.Background(), req)
+
+	if err != nil {
+		t.Errorf("expected no error but got: %v", err)
+	}
+
+	if len(rsp.GetResults()) == 0 {
+		t.Fatal("expected fatal result but got none")
+	}
+
+	result := rsp.GetResults()[0]
+	if result.GetSeverity() != fnv1.Severity_SEVERITY_FATAL {
+		t.Errorf("expected SEVERITY_FATAL but got: %v", result.GetSeverity())
+	}
+	if !strings.Contains(result.GetMessage(), "both use status field status.approved") {
+		t.Errorf("expected fatal message to name the shared field but got: %v", result.GetMessage())
+	}
+}
+
+func TestFunction_InvalidGates(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	cases := map[string]struct {
+		input string
+		want  string
+	}{
+		"NameWithDot": {
+			input: `"gates": [{"name": "security.approved", "dataField": "spec.resources"}]`,
+			want:  `gate name "security.approved" must be a DNS label`,
+		},
+		"NameWithSlash": {
+			input: `"gates": [{"name": "example.com/security", "dataField": "spec.resources"}]`,
+			want:  `gate name "example.com/security" must be a DNS label`,
+		},
+		"NameTooLong": {
+			input: `"gates": [{"name": "` + strings.Repeat("a", 64) + `", "dataField": "spec.resources"}]`,
+			want:  "must be a DNS label",
+		},
+		"DuplicateName": {
+			input: `"gates": [{"name": "security", "dataField": "spec.resources"}, {"name": "security", "dataField": "spec.parameters"}]`,
+			want:  "gate security is listed more than once",
+		},
+		"TopLevelIgnorePaths": {
+			input: `"ignorePaths": ["spec.resources.tags"], "gates": [{"name": "security", "dataField": "spec.resources"}]`,
+			want:  "cannot be combined with gates",
+		},
+		"TopLevelNormalization": {
+			input: `"normalization": {"trimStrings": true}, "gates": [{"name": "security", "dataField": "spec.resources"}]`,
+			want:  "cannot be combined with gates",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := &fnv1.RunFunctionRequest{
+				Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+				Input: resource.MustStructJSON(`{
+					"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+					"kind": "Input",
+					` + tc.input + `
+				}`),
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{
+						Resource: resource.MustStructJSON(`{
+							"apiVersion": "example.org/v1",
+							"kind": "XR",
+							"metadata": {
+								"name": "test-xr"
+							}
+						}`),
+					},
+				},
+			}
+
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Errorf("expected no error but got: %v", err)
+			}
+
+			if len(rsp.GetResults()) == 0 {
+				t.Fatal("expected fatal result but got none")
+			}
+			result := rsp.GetResults()[0]
+			if result.GetSeverity() != fnv1.Severity_SEVERITY_FATAL {
+				t.Errorf("expected SEVERITY_FATAL but got: %v", result.GetSeverity())
+			}
+			if !strings.Contains(result.GetMessage(), tc.want) {
+				t.Errorf("expected fatal message to contain %q but got: %v", tc.want, result.GetMessage())
+			}
+		})
+	}
+}
+
+func TestFunction_PathExpressions(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	xr := `{
+		"apiVersion": "example.org/v1",
+		"kind": "XR",
+		"metadata": {
+			"name": "test-xr",
+			"annotations": {
+				"example.com/tier": "gold"
+			}
+		},
+		"spec": {
+			"resources": {
+				"users": [{"name": "alice"}]
+			}
+		}
+	}`
+
+	req := &fnv1.RunFunctionRequest{
+		Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+		Input: resource.MustStructJSON(`{
+			"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+			"kind": "Input",
+			"dataFields": ["spec", "spec.resources.users[0]", "metadata.annotations[\"example.com/tier\"]"],
+			"pendingHashField": "status.approval[\"pending.hash\"]"
+		}`),
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+		Desired: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+	}
+
+	rsp, err := f.RunFunction(context.Background(), req)
+
+	if err != nil {
+		t.Errorf("expected no error but got: %v", err)
+	}
+
+	// All paths resolve, so the only result is the request for approval
+	for _, result := range rsp.GetResults() {
+		if !strings.Contains(result.GetMessage(), "Changes detected. Approval required.") {
+			t.Errorf("expected only an approval result but got: %v", result.GetMessage())
+		}
+	}
+
+	status := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	approval, ok := status["approval"].(map[string]interface{})
+	if !ok || approval["pending.hash"] == nil {
+		t.Errorf("expected pending hash under a quoted key but got: %v", status)
+	}
+}
+
+func TestFunction_WildcardDataField(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	// Hashes of "large" and "small"
+	const (
+		largeHash = "8dd8c429f56aeaccae1c540f78a366e07f80c0a73bb128291b6bca3ba349abc9"
+		smallHash = "300694740fd6f600a0011c69d5ceb0604f79dd7f96b0cbd87ffb1952d614a7ff"
+	)
+
+	xr := `{
+		"apiVersion": "example.org/v1",
+		"kind": "XR",
+		"metadata": {
+			"name": "test-xr"
+		},
+		"spec": {
+			"resources": {
+				"cache": {"size": "large"},
+				"db": {"size": "large"},
+				"queue": {"size": "small"}
+			}
+		},
+		"status": {
+			"currentHash": "e02c6d35c585a43c62dc2ae14a5385b8a86168b36be7a0d985c0c09afca4ffbe",
+			"fieldHashes": {
+				"spec.resources.cache.size": "` + smallHash + `",
+				"spec.resources.db.size": "` + largeHash + `",
+				"spec.resources.search.size": "` + smallHash + `"
+			}
+		}
+	}`
+
+	req := &fnv1.RunFunctionRequest{
+		Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+		Input: resource.MustStructJSON(`{
+			"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+			"kind": "Input",
+			"dataField": "spec.resources.*.size"
+		}`),
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+		Desired: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+	}
+
+	rsp, err := f.RunFunction(context.Background(), req)
+
+	if err != nil {
+		t.Errorf("expected no error but got: %v", err)
+	}
+
+	hasApprovalRequired := false
+	for _, cond := range rsp.GetConditions() {
+		if cond.GetType() == approvalRequiredCondition {
+			hasApprovalRequired = true
+			message := cond.GetMessage()
+			for _, want := range []string{
+				"- spec.resources.*.size: 3 matched",
+				"  - spec.resources.cache.size: changed",
+				"  - spec.resources.db.size: unchanged",
+				"  - spec.resources.queue.size: added",
+				"- spec.resources.search.size: removed",
+			} {
+				if !strings.Contains(message, want) {
+					t.Errorf("expected condition message to contain %q but got: %v", want, message)
+				}
+			}
+		}
+	}
+
+	if !hasApprovalRequired {
+		t.Error("expected to find ApprovalRequired condition but didn't")
+	}
+}
+
+func TestFunction_IgnorePaths(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	// Hashes of {"db":{"size":"large"}}, {"team":"a"} and {"team":"b"}
+	const (
+		dataHash  = "f065308a3ff216c7f8fcb0faa24c1aff36feb0320d88199cc813a8d507eed79f"
+		teamAHash = "a13b8de7a1a347e08828be9366fbe25434200f3720dcf7b2519ac3ad5a352c28"
+		teamBHash = "012e43ebb6faa37cde29b864f2ba070915c8167a25815d5e280c66fd2c25f6e8"
+	)
+
+	xr := `{
+		"apiVersion": "example.org/v1",
+		"kind": "XR",
+		"metadata": {
+			"name": "test-xr"
+		},
+		"spec": {
+			"resources": {
+				"db": {"size": "large", "tags": {"team": "b"}}
+			}
+		},
+		"status": {
+			"currentHash": "` + dataHash + `",
+			"ignoredHashes": {
+				"spec.resources.db.tags": "` + teamAHash + `"
+			}
+		}
+	}`
+
+	req := &fnv1.RunFunctionRequest{
+		Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+		Input: resource.MustStructJSON(`{
+			"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+			"kind": "Input",
+			"dataField": "spec.resources",
+			"ignorePaths": ["spec.resources.*.tags"]
+		}`),
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+		Desired: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+		},
+	}
+
+	rsp, err := f.RunFunction(context.Background(), req)
+
+	if err != nil {
+		t.Errorf("expected no error but got: %v", err)
+	}
+
+	// The tags changed, but they are ignored so no approval is required
+	for _, cond := range rsp.GetConditions() {
+		if cond.GetType() == approvalRequiredCondition {
+			t.Errorf("expected no ApprovalRequired condition but got: %v", cond.GetMessage())
+		}
+	}
+
+	hasIgnoredResult := false
+	for _, result := range rsp.GetResults() {
+		if result.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			t.Errorf("expected no fatal results but got: %v", result.GetMessage())
+		}
+		if strings.Contains(result.GetMessage(), "Ignored fields changed without requiring approval: spec.resources.db.tags") {
+			hasIgnoredResult = true
+		}
+	}
+
+	if !hasIgnoredResult {
+		t.Errorf("expected a result listing the changed ignored fields but got: %v", rsp.GetResults())
+	}
+
+	status := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	ignoredHashes, ok := status["ignoredHashes"].(map[string]interface{})
+	if !ok || ignoredHashes["spec.resources.db.tags"] != hashPrefix+teamBHash {
+		t.Errorf("expected the new ignored field hash to be recorded but got: %v", status["ignoredHashes"])
+	}
+}
+
+func TestFunction_HashUpgrade(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	// A legacy bare SHA-256 digest of {"test":"data "}, and the SHA-512
+	// digest of the same data with strings trimmed
+	const (
+		legacyHash = "808ae13e2181bf9f8ad9b2aa89ebce335fe588b0e0b1f858162c986b8da98f4c"
+		sha512Hash = "579c6b3cb7cd53095a191178791be14d8113b47f23a7611c28782c9fbb96239680f62b0fd816d385b5660930c8451169a37dec7465691eb8cc68488d768d85dc"
+	)
+
+	cases := map[string]struct {
+		data        string
+		wantUpgrade bool
+	}{
+		"Unchanged": {data: `{"test": "data "}`, wantUpgrade: true},
+		"Changed":   {data: `{"test": "other data"}`, wantUpgrade: false},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			xr := `{
+				"apiVersion": "example.org/v1",
+				"kind": "XR",
+				"metadata": {
+					"name": "test-xr"
+				},
+				"spec": {
+					"resources": ` + tc.data + `
+				},
+				"status": {
+					"currentHash": "` + legacyHash + `"
+				}
+			}`
+
+			req := &fnv1.RunFunctionRequest{
+				Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+				Input: resource.MustStructJSON(`{
+					"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+					"kind": "Input",
+					"dataField": "spec.resources",
+					"hashAlgorithm": "sha512",
+					"normalization": {"trimStrings": true}
+				}`),
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				},
+				Desired: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				},
+			}
+
+			rsp, err := f.RunFunction(context.Background(), req)
+
+			if err != nil {
+				t.Errorf("expected no error but got: %v", err)
+			}
+
+			needsApproval := false
+			for _, cond := range rsp.GetConditions() {
+				if cond.GetType() == approvalRequiredCondition {
+					needsApproval = true
+				}
+			}
+			if needsApproval == tc.wantUpgrade {
+				t.Errorf("expected approval required to be %t but got: %v", !tc.wantUpgrade, rsp.GetConditions())
+			}
+
+			status := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+			want := legacyHash
+			if tc.wantUpgrade {
+				want = "sha512:v1:" + sha512Hash
+			}
+			if status["currentHash"] != want {
+				t.Errorf("expected currentHash to be %s but got: %v", want, status["currentHash"])
+			}
+		})
+	}
+}
+
+func TestFunction_HashUpgradeAfterSettingsChange(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	xr := resource.MustStructJSON(`{
+		"apiVersion": "example.org/v1",
+		"kind": "XR",
+		"metadata": {
+			"name": "test-xr"
+		},
+		"spec": {
+			"resources": {
+				"zones": ["b", "a"],
+				"labels": {}
+			}
+		},
+		"status": {
+			"approved": true
+		}
+	}`)
+
+	// The data is approved while empty fields are dropped
+	rsp, err := f.RunFunction(context.Background(), &fnv1.RunFunctionRequest{
+		Input: resource.MustStructJSON(`{
+			"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+			"kind": "Input",
+			"dataField": "spec.resources",
+			"normalization": {"dropEmpty": true}
+		}`),
+		Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: xr}},
+		Desired:  &fnv1.State{Composite: &fnv1.Resource{Resource: xr}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+
+	status := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	approvedHash, _ := status["currentHash"].(string)
+	if approvedHash == "" {
+		t.Fatalf("expected the data to be approved but got: %v", rsp.GetConditions())
+	}
+
+	// Treating the zones as a set changes the hash, but not the data
+	xr = rsp.GetDesired().GetComposite().GetResource()
+	rsp, err = f.RunFunction(context.Background(), &fnv1.RunFunctionRequest{
+		Input: resource.MustStructJSON(`{
+			"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+			"kind": "Input",
+			"dataField": "spec.resources",
+			"normalization": {"dropEmpty": true, "setPaths": ["spec.resources.zones"]}
+		}`),
+		Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: xr}},
+		Desired:  &fnv1.State{Composite: &fnv1.Resource{Resource: xr}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+
+	for _, cond := range rsp.GetConditions() {
+		if cond.GetType() == approvalRequiredCondition {
+			t.Errorf("expected the hash to be upgraded without approval but got: %v", rsp.GetConditions())
+		}
+	}
+
+	status = rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	if status["currentHash"] == approvedHash {
+		t.Errorf("expected currentHash to be upgraded from %s", approvedHash)
+	}
+}
+
+func TestFunction_HashKey(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	// The hash of {"test":"data"}, and the same hash sealed with the key
+	// "secret"
+	const (
+		hash       = hashPrefix + "e1d7c49f3a04e1ec1a5b150ec68041c903cd75fda52aa1239fd586439ef1154b"
+		sealedHash = hash + ":922164b1a355fa568b4441ea3810a6936995d9cc012db97dfb79f81b752d707f"
+	)
+
+	cases := map[string]struct {
+		currentHash  string
+		wantTampered bool
+	}{
+		"Sealed":      {currentHash: sealedHash, wantTampered: false},
+		"Unsealed":    {currentHash: hash, wantTampered: true},
+		"ForgedSeal":  {currentHash: hash + ":0123456789abcdef", wantTampered: true},
+		"LegacyForge": {currentHash: "e1d7c49f3a04e1ec1a5b150ec68041c903cd75fda52aa1239fd586439ef1154b", wantTampered: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			xr := `{
+				"apiVersion": "example.org/v1",
+				"kind": "XR",
+				"metadata": {
+					"name": "test-xr"
+				},
+				"spec": {
+					"resources": {
+						"test": "data"
+					}
+				},
+				"status": {
+					"currentHash": "` + tc.currentHash + `"
+				}
+			}`
+
+			req := &fnv1.RunFunctionRequest{
+				Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+				Input: resource.MustStructJSON(`{
+					"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+					"kind": "Input",
+					"dataField": "spec.resources",
+					"hashKey": {"credentialsName": "approval-key"}
+				}`),
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				},
+				Desired: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				},
+				Credentials: map[string]*fnv1.Credentials{
+					"approval-key": {
+						Source: &fnv1.Credentials_CredentialData{
+							CredentialData: &fnv1.CredentialData{Data: map[string][]byte{"key": []byte("secret\n")}},
+						},
+					},
+				},
+			}
+
+			rsp, err := f.RunFunction(context.Background(), req)
+
+			if err != nil {
+				t.Errorf("expected no error but got: %v", err)
+			}
+
+			tampered := false
+			for _, cond := range rsp.GetConditions() {
+				if cond.GetType() == approvalRequiredCondition && cond.GetReason() == "HashTampered" {
+					tampered = true
+				}
+			}
+			if tampered != tc.wantTampered {
+				t.Errorf("expected tampering to be reported %t but got: %v", tc.wantTampered, rsp.GetConditions())
+			}
+
+			status := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+			if !tc.wantTampered && status["currentHash"] != sealedHash {
+				t.Errorf("expected currentHash to stay sealed as %s but got: %v", sealedHash, status["currentHash"])
+			}
+			if tc.wantTampered && status["pendingHash"] != hash {
+				t.Errorf("expected pendingHash to be %s but got: %v", hash, status["pendingHash"])
+			}
+		})
+	}
+}
+
+func TestFunction_ApprovedSnapshotDiff(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	run := func(resources, status string) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": ` + resources + `
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"patchField": "status.pendingChange"
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	// Approve the first version of the data, which stores a snapshot of it
+	rsp := run(`{"size": "large", "zones": ["a", "b"]}`, `{"approved": true}`)
+	status := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	if s, ok := status["approvedSnapshot"].(string); !ok || s == "" {
+		t.Fatalf("expected an approved snapshot to be stored but got: %v", status)
+	}
+
+	approved, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+
+	// Change the data, which should show what changed since the approval
+	rsp = run(`{"size": "small", "zones": ["a"]}`, string(approved))
+
+	hasDiff := false
+	for _, cond := range rsp.GetConditions() {
+		if cond.GetType() != approvalRequiredCondition {
+			continue
+		}
+		message := cond.GetMessage()
+		hasDiff = strings.Contains(message, "Changes since the last approval:") &&
+			strings.Contains(message, `- spec.resources.size changed: "large" → "small"`) &&
+			strings.Contains(message, `- spec.resources.zones[1] removed: "b"`)
+		if !hasDiff {
+			t.Errorf("expected the condition message to show what changed but got: %v", message)
+		}
+	}
+
+	if !hasDiff {
+		t.Error("expected to find ApprovalRequired condition with the changes but didn't")
+	}
+
+	// The same change is published as patches for tools
+	status = rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	pending, ok := status["pendingChange"].(map[string]interface{})
+	if !ok || pending["hash"] != status["pendingHash"] {
+		t.Fatalf("expected the pending change to be published for the pending hash but got: %v", status["pendingChange"])
+	}
+
+	wantPatch := []interface{}{
+		map[string]interface{}{"op": "replace", "path": "/spec/resources/size", "value": "small"},
+		map[string]interface{}{"op": "remove", "path": "/spec/resources/zones/1"},
+	}
+	if !reflect.DeepEqual(pending["jsonPatch"], wantPatch) {
+		t.Errorf("expected JSON patch %v but got: %v", wantPatch, pending["jsonPatch"])
+	}
+
+	wantMerge := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"resources": map[string]interface{}{"size": "small", "zones": []interface{}{"a"}},
+		},
+	}
+	if !reflect.DeepEqual(pending["mergePatch"], wantMerge) {
+		t.Errorf("expected merge patch %v but got: %v", wantMerge, pending["mergePatch"])
+	}
+
+	// The data isn't normalized, so the patches apply to the XR as it is
+	if normalized, ok := pending["normalized"]; ok {
+		t.Errorf("expected the patches not to be marked as normalized but got: %v", normalized)
+	}
+}
+
+func TestFunction_RequireApprovalFor(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	run := func(resources, status string) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": ` + resources + `
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"requireApprovalFor": ["Destructive"]
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	// Approve the first version of the data, which stores a snapshot of it
+	rsp := run(`{"storage": "100Gi", "zones": ["a"]}`, `{"approved": true}`)
+	approved, err := json.Marshal(rsp.GetDesired().GetComposite().GetResource().AsMap()["status"])
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+
+	// Adding a zone and growing the storage doesn't destroy anything
+	rsp = run(`{"storage": "200Gi", "zones": ["a", "b"]}`, string(approved))
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			t.Fatalf("expected the additive change to go through but got: %v", r.GetMessage())
+		}
+	}
+
+	grown, err := json.Marshal(rsp.GetDesired().GetComposite().GetResource().AsMap()["status"])
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+
+	// Shrinking the storage is destructive, so it needs approval
+	rsp = run(`{"storage": "50Gi", "zones": ["a", "b"]}`, string(grown))
+
+	hasClass := false
+	for _, cond := range rsp.GetConditions() {
+		if cond.GetType() != approvalRequiredCondition {
+			continue
+		}
+		message := cond.GetMessage()
+		hasClass = strings.Contains(message, `- spec.resources.storage changed: "200Gi" → "50Gi" (destructive)`) &&
+			strings.Contains(message, "Change classes requiring approval: Destructive")
+		if !hasClass {
+			t.Errorf("expected the condition message to classify the change but got: %v", message)
+		}
+	}
+
+	if !hasClass {
+		t.Error("expected to find ApprovalRequired condition with the change classes but didn't")
+	}
+}
+
+func TestFunction_ForgedSnapshot(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	run := func(resources string, status map[string]interface{}) *fnv1.RunFunctionResponse {
+		encoded, err := json.Marshal(status)
+		if err != nil {
+			t.Fatalf("cannot marshal status: %v", err)
+		}
+
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": ` + resources + `
+			},
+			"status": ` + string(encoded) + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"requireApprovalFor": ["Destructive"],
+				"hashKey": {"credentialsName": "approval-key"}
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Credentials: map[string]*fnv1.Credentials{
+				"approval-key": {
+					Source: &fnv1.Credentials_CredentialData{
+						CredentialData: &fnv1.CredentialData{Data: map[string][]byte{"key": []byte("secret")}},
+					},
+				},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	fatal := func(rsp *fnv1.RunFunctionResponse) bool {
+		for _, r := range rsp.GetResults() {
+			if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Approve the first version of the data, which stores a sealed snapshot
+	rsp := run(`{"storage": "100Gi"}`, map[string]interface{}{"approved": true})
+	approved := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+
+	// Growing the storage is checked against the sealed snapshot
+	if rsp := run(`{"storage": "200Gi"}`, approved); fatal(rsp) {
+		t.Errorf("expected the additive change to go through but got: %v", rsp.GetResults())
+	}
+
+	// A snapshot claiming the approved storage was smaller would make
+	// shrinking it look additive
+	h := parseHash(approved["currentHash"].(string))
+	h.MAC = ""
+	forged, err := encodeSnapshot(&snapshot{Hash: h.String(), Fields: map[string]interface{}{
+		"spec.resources": map[string]interface{}{"storage": "10Gi"},
+	}})
+	if err != nil {
+		t.Fatalf("cannot encode snapshot: %v", err)
+	}
+	approved["approvedSnapshot"] = forged
+
+	if rsp := run(`{"storage": "50Gi"}`, approved); !fatal(rsp) {
+		t.Error("expected a change checked against a forged snapshot to require approval")
+	}
+}
+
+func TestFunction_AutoApprove(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	run := func(replicas, status string) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": {"replicas": ` + replicas + `}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"autoApprove": [
+					{"name": "scale-up", "expression": "new.replicas >= old.replicas && new.replicas <= old.replicas * 2"}
+				]
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	rsp := run(`3`, `{"approved": true}`)
+	approved, err := json.Marshal(rsp.GetDesired().GetComposite().GetResource().AsMap()["status"])
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+
+	// Doubling the replicas is approved by the rule
+	rsp = run(`6`, string(approved))
+	hasRule := false
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			t.Fatalf("expected the change to be approved by the rule but got: %v", r.GetMessage())
+		}
+		if strings.Contains(r.GetMessage(), "Approved by auto-approval rule scale-up") {
+			hasRule = true
+		}
+	}
+	if !hasRule {
+		t.Errorf("expected a result naming the rule that approved the change but got: %v", rsp.GetResults())
+	}
+
+	// Tripling them isn't
+	rsp = run(`9`, string(approved))
+	hasFatal := false
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			hasFatal = true
+		}
+	}
+	if !hasFatal {
+		t.Error("expected the change to require approval")
+	}
+}
+
+func TestFunction_Tolerances(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	run := func(storage, status string) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": {"storage": "` + storage + `"}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"tolerances": [
+					{"path": "spec.resources.storage", "maxIncrease": "20%"}
+				]
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	hasFatal := func(rsp *fnv1.RunFunctionResponse) bool {
+		for _, r := range rsp.GetResults() {
+			if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+				return true
+			}
+		}
+		return false
+	}
+
+	rsp := run("100Gi", `{"approved": true}`)
+	approved, err := json.Marshal(rsp.GetDesired().GetComposite().GetResource().AsMap()["status"])
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+
+	// A small increase is within the tolerance
+	rsp = run("110Gi", string(approved))
+	if hasFatal(rsp) {
+		t.Errorf("expected the increase within the tolerance to be approved but got: %v", rsp.GetResults())
+	}
+	tolerated, err := json.Marshal(rsp.GetDesired().GetComposite().GetResource().AsMap()["status"])
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+
+	// Small increases don't add up to a large one. Growing to 125Gi is within
+	// 20% of 110Gi, but not of the manually approved 100Gi.
+	if rsp := run("125Gi", string(tolerated)); !hasFatal(rsp) {
+		t.Error("expected increases adding up beyond the tolerance to require approval")
+	}
+	if rsp := run("115Gi", string(tolerated)); hasFatal(rsp) {
+		t.Errorf("expected increases adding up to within the tolerance to be approved but got: %v", rsp.GetResults())
+	}
+
+	// A large one isn't
+	if rsp := run("200Gi", string(approved)); !hasFatal(rsp) {
+		t.Error("expected the increase beyond the tolerance to require approval")
+	}
+
+	// Neither is a decrease
+	if rsp := run("90Gi", string(approved)); !hasFatal(rsp) {
+		t.Error("expected the decrease to require approval")
+	}
+}
+
+func TestFunction_HashDesiredResources(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	run := func(dbSize, dbTag, bucketRegion, status string) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"desiredResources": {
+					"kind": "Instance",
+					"ignorePaths": ["spec.forProvider.tags"]
+				}
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				Resources: map[string]*fnv1.Resource{
+					"db": {Resource: resource.MustStructJSON(`{
+						"apiVersion": "rds.aws.upbound.io/v1beta1",
+						"kind": "Instance",
+						"spec": {"forProvider": {"instanceClass": "` + dbSize + `", "tags": {"team": "` + dbTag + `"}}}
+					}`)},
+					"bucket": {Resource: resource.MustStructJSON(`{
+						"apiVersion": "s3.aws.upbound.io/v1beta1",
+						"kind": "Bucket",
+						"spec": {"forProvider": {"region": "` + bucketRegion + `"}}
+					}`)},
+				},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	hasFatal := func(rsp *fnv1.RunFunctionResponse) bool {
+		for _, r := range rsp.GetResults() {
+			if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+				return true
+			}
+		}
+		return false
+	}
+
+	rsp := run("db.t3.micro", "a", "us-east-1", `{"approved": true}`)
+	if hasFatal(rsp) {
+		t.Fatalf("expected the approved resources to go through but got: %v", rsp.GetResults())
+	}
+	approved, err := json.Marshal(rsp.GetDesired().GetComposite().GetResource().AsMap()["status"])
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+
+	// Changes to resources that aren't selected, and to ignored fields, don't
+	// require approval
+	if rsp := run("db.t3.micro", "b", "eu-west-1", string(approved)); hasFatal(rsp) {
+		t.Errorf("expected changes outside the watched resources to go through but got: %v", rsp.GetResults())
+	}
+
+	// Changes rendered into a selected resource do
+	rsp = run("db.r5.large", "a", "us-east-1", string(approved))
+	if !hasFatal(rsp) {
+		t.Fatal("expected the change to the selected resource to require approval")
+	}
+
+	hasDiff := false
+	for _, cond := range rsp.GetConditions() {
+		if cond.GetType() == approvalRequiredCondition {
+			hasDiff = strings.Contains(cond.GetMessage(), `- desiredResources.db.spec.forProvider.instanceClass changed: "db.t3.micro" → "db.r5.large"`)
+		}
+	}
+	if !hasDiff {
+		t.Errorf("expected the condition to show the change to the resource but got: %v", rsp.GetConditions())
+	}
+}
+
+func TestFunction_HoldChangedResources(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	db := func(class string) *fnv1.Resource {
+		return &fnv1.Resource{Resource: resource.MustStructJSON(`{
+			"apiVersion": "rds.aws.upbound.io/v1beta1",
+			"kind": "Instance",
+			"metadata": {"name": "db"},
+			"spec": {"forProvider": {"instanceClass": "` + class + `"}}
+		}`)}
+	}
+	bucket := &fnv1.Resource{Resource: resource.MustStructJSON(`{
+		"apiVersion": "s3.aws.upbound.io/v1beta1",
+		"kind": "Bucket",
+		"metadata": {"name": "bucket"}
+	}`)}
+
+	run := func(class, status string, desired map[string]*fnv1.Resource) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": {"class": "` + class + `"}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"enforcement": "HoldChanged"
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				Resources: map[string]*fnv1.Resource{
+					"db":     db("db.t3.micro"),
+					"bucket": bucket,
+				},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				Resources: desired,
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	rsp := run("db.t3.micro", `{"approved": true}`, map[string]*fnv1.Resource{
+		"db":     db("db.t3.micro"),
+		"bucket": bucket,
+	})
+	status := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	if hashes, ok := status["resourceHashes"].(map[string]interface{}); !ok || len(hashes) != 2 {
+		t.Fatalf("expected a hash per composed resource but got: %v", status["resourceHashes"])
+	}
+	approved, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+
+	// The change renders a new instance class and a new queue
+	queue := &fnv1.Resource{Resource: resource.MustStructJSON(`{
+		"apiVersion": "sqs.aws.upbound.io/v1beta1",
+		"kind": "Queue",
+		"metadata": {"name": "queue"}
+	}`)}
+	rsp = run("db.r5.large", string(approved), map[string]*fnv1.Resource{
+		"db":     db("db.r5.large"),
+		"bucket": bucket,
+		"queue":  queue,
+	})
+
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			t.Fatalf("expected the pipeline to continue but got: %v", r.GetMessage())
+		}
+	}
+
+	resources := rsp.GetDesired().GetResources()
+	class := resources["db"].GetResource().AsMap()["spec"].(map[string]interface{})["forProvider"].(map[string]interface{})["instanceClass"]
+	if class != "db.t3.micro" {
+		t.Errorf("expected the changed resource to be held at its observed state but got instance class %v", class)
+	}
+	if _, ok := resources["queue"]; !ok {
+		t.Error("expected the new resource to be created")
+	}
+	if _, ok := resources["bucket"]; !ok {
+		t.Error("expected the unchanged resource to keep reconciling")
+	}
+
+	hasHeld := false
+	for _, cond := range rsp.GetConditions() {
+		if cond.GetType() == approvalRequiredCondition {
+			hasHeld = strings.Contains(cond.GetMessage(), "Resources awaiting approval:\n- db")
+		}
+	}
+	if !hasHeld {
+		t.Errorf("expected the condition to list the held resources but got: %v", rsp.GetConditions())
+	}
+}
+
+func TestFunction_HoldApprovedResources(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	db := func(class string) *fnv1.Resource {
+		return &fnv1.Resource{Resource: resource.MustStructJSON(`{
+			"apiVersion": "rds.aws.upbound.io/v1beta1",
+			"kind": "Instance",
+			"metadata": {"name": "db"},
+			"spec": {"forProvider": {"instanceClass": "` + class + `"}}
+		}`)}
+	}
+
+	run := func(class, status string) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": {"class": "` + class + `"}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"enforcement": "Hold"
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				Resources: map[string]*fnv1.Resource{
+					"db": db("db.t3.micro"),
+				},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				Resources: map[string]*fnv1.Resource{
+					"db": db(class),
+				},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	rsp := run("db.t3.micro", `{"approved": true}`)
+	status := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	if s, ok := status["approvedResources"].(string); !ok || s == "" {
+		t.Fatalf("expected the approved resources to be stored but got: %v", status)
+	}
+	approved, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+
+	rsp = run("db.r5.large", string(approved))
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			t.Fatalf("expected the pipeline to continue but got: %v", r.GetMessage())
+		}
+	}
+
+	class := rsp.GetDesired().GetResources()["db"].GetResource().AsMap()["spec"].(map[string]interface{})["forProvider"].(map[string]interface{})["instanceClass"]
+	if class != "db.t3.micro" {
+		t.Errorf("expected the approved rendering to be held but got instance class %v", class)
+	}
+
+	// The composite's status is still written alongside the held resources
+	status = rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	if status["pendingHash"] == "" {
+		t.Errorf("expected the pending hash to be published but got: %v", status)
+	}
+
+	// A rendering written to the status can't add resources to the
+	// composition
+	var forged map[string]interface{}
+	if err := json.Unmarshal(approved, &forged); err != nil {
+		t.Fatalf("cannot unmarshal status: %v", err)
+	}
+	forged["approvedResources"], err = encodeApprovedResources(map[string]interface{}{
+		"db":    db("db.t3.micro").GetResource().AsMap(),
+		"extra": map[string]interface{}{"apiVersion": "iam.aws.upbound.io/v1beta1", "kind": "Role"},
+	}, forged["currentHash"].(string), nil)
+	if err != nil {
+		t.Fatalf("cannot encode approved resources: %v", err)
+	}
+	encoded, err := json.Marshal(forged)
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+
+	rsp = run("db.r5.large", string(encoded))
+	if _, ok := rsp.GetDesired().GetResources()["extra"]; ok {
+		t.Error("expected a resource that is neither desired nor observed not to be composed")
+	}
+}
+
+func TestFunction_PauseResources(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	db := func(class string) *fnv1.Resource {
+		return &fnv1.Resource{Resource: resource.MustStructJSON(`{
+			"apiVersion": "rds.aws.upbound.io/v1beta1",
+			"kind": "Instance",
+			"metadata": {"name": "db"},
+			"spec": {"forProvider": {"instanceClass": "` + class + `"}}
+		}`)}
+	}
+	bucket := &fnv1.Resource{Resource: resource.MustStructJSON(`{
+		"apiVersion": "s3.aws.upbound.io/v1beta1",
+		"kind": "Bucket",
+		"metadata": {"name": "bucket"}
+	}`)}
+
+	run := func(class, status string) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": {"class": "` + class + `"}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"enforcement": "Pause"
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				Resources: map[string]*fnv1.Resource{
+					"db":     db("db.t3.micro"),
+					"bucket": bucket,
+				},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				Resources: map[string]*fnv1.Resource{
+					"db":     db(class),
+					"bucket": bucket,
+				},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	paused := func(rsp *fnv1.RunFunctionResponse, name string) interface{} {
+		metadata, _ := rsp.GetDesired().GetResources()[name].GetResource().AsMap()["metadata"].(map[string]interface{})
+		annotations, _ := metadata["annotations"].(map[string]interface{})
+		return annotations[pausedAnnotation]
+	}
+	statusOf := func(rsp *fnv1.RunFunctionResponse) map[string]interface{} {
+		return rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	}
+
+	rsp := run("db.t3.micro", `{"approved": true}`)
+	approved, err := json.Marshal(statusOf(rsp))
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+
+	rsp = run("db.r5.large", string(approved))
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			t.Fatalf("expected the pipeline to continue but got: %v", r.GetMessage())
+		}
+	}
+	if got := paused(rsp, "db"); got != "true" {
+		t.Errorf("expected the changed resource to be paused but got annotation %v", got)
+	}
+	if got := paused(rsp, "bucket"); got != nil {
+		t.Errorf("expected the unchanged resource to keep reconciling but got annotation %v", got)
+	}
+	status := statusOf(rsp)
+	if got := status["pausedResources"]; !reflect.DeepEqual(got, []interface{}{"db"}) {
+		t.Fatalf("expected the paused resources to be recorded but got: %v", got)
+	}
+
+	// Approving the change unpauses the resources that were paused
+	status["approved"] = true
+	pending, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+	rsp = run("db.r5.large", string(pending))
+	if got := paused(rsp, "db"); got != "false" {
+		t.Errorf("expected the approved resource to be unpaused but got annotation %v", got)
+	}
+	if got := statusOf(rsp)["pausedResources"]; !reflect.DeepEqual(got, []interface{}{}) {
+		t.Errorf("expected the paused resources to be cleared but got: %v", got)
+	}
+}
+
+func TestFunction_PauseResourcesAcrossGates(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	db := func(class string) *fnv1.Resource {
+		return &fnv1.Resource{Resource: resource.MustStructJSON(`{
+			"apiVersion": "rds.aws.upbound.io/v1beta1",
+			"kind": "Instance",
+			"metadata": {"name": "db"},
+			"spec": {"forProvider": {"instanceClass": "` + class + `"}}
+		}`)}
+	}
+
+	run := func(class, size, status string) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": {"class": "` + class + `"},
+				"parameters": {"size": "` + size + `"}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"enforcement": "Pause",
+				"gates": [
+					{"name": "security", "dataField": "spec.resources"},
+					{"name": "cost", "dataField": "spec.parameters"}
+				]
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				Resources: map[string]*fnv1.Resource{"db": db("db.t3.micro")},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				Resources: map[string]*fnv1.Resource{"db": db(class)},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	paused := func(rsp *fnv1.RunFunctionResponse) interface{} {
+		metadata, _ := rsp.GetDesired().GetResources()["db"].GetResource().AsMap()["metadata"].(map[string]interface{})
+		annotations, _ := metadata["annotations"].(map[string]interface{})
+		return annotations[pausedAnnotation]
+	}
+	statusOf := func(rsp *fnv1.RunFunctionResponse) map[string]interface{} {
+		return rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	}
+	approve := func(rsp *fnv1.RunFunctionResponse, gates ...string) string {
+		status := statusOf(rsp)
+		for _, name := range gates {
+			gate, _ := status["gates"].(map[string]interface{})[name].(map[string]interface{})
+			gate["approved"] = true
+		}
+		b, err := json.Marshal(status)
+		if err != nil {
+			t.Fatalf("cannot marshal status: %v", err)
+		}
+		return string(b)
+	}
+
+	rsp := run("db.t3.micro", "small", `{"gates": {"security": {"approved": true}, "cost": {"approved": true}}}`)
+
+	// Both gates wait for a change that affects the same resource
+	rsp = run("db.r5.large", "large", approve(rsp))
+	if got := paused(rsp); got != "true" {
+		t.Fatalf("expected the changed resource to be paused but got annotation %v", got)
+	}
+
+	// Approving one gate doesn't unpause a resource the other gate pauses
+	rsp = run("db.r5.large", "large", approve(rsp, "cost"))
+	if got := paused(rsp); got != "true" {
+		t.Errorf("expected the resource to stay paused while a gate waits but got annotation %v", got)
+	}
+
+	// Once every gate is approved the resource is unpaused
+	rsp = run("db.r5.large", "large", approve(rsp, "security"))
+	if got := paused(rsp); got != "false" {
+		t.Errorf("expected the resource to be unpaused but got annotation %v", got)
+	}
+}
+
+func TestFunction_WarningEnforcement(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	run := func(value, status string) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": {"value": "` + value + `"}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"enforcement": "Warning"
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	statusOf := func(rsp *fnv1.RunFunctionResponse) map[string]interface{} {
+		return rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	}
+	next := func(rsp *fnv1.RunFunctionResponse) string {
+		b, err := json.Marshal(statusOf(rsp))
+		if err != nil {
+			t.Fatalf("cannot marshal status: %v", err)
+		}
+		return string(b)
+	}
+	condition := func(rsp *fnv1.RunFunctionResponse, conditionType string) *fnv1.Condition {
+		for _, c := range rsp.GetConditions() {
+			if c.GetType() == conditionType {
+				return c
+			}
+		}
+		return nil
+	}
+
+	rsp := run("a", `{}`)
+	hasWarning := false
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			t.Fatalf("expected the change to be let through but got: %v", r.GetMessage())
+		}
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_WARNING {
+			hasWarning = true
+		}
+	}
+	if !hasWarning {
+		t.Errorf("expected a warning result but got: %v", rsp.GetResults())
+	}
+	if c := condition(rsp, "ApprovalWouldBeRequired"); c.GetStatus() != fnv1.Status_STATUS_CONDITION_TRUE {
+		t.Errorf("expected the ApprovalWouldBeRequired condition to be true but got: %v", c)
+	}
+	if c := condition(rsp, approvalRequiredCondition); c != nil {
+		t.Errorf("expected no ApprovalRequired condition but got: %v", c)
+	}
+	status := statusOf(rsp)
+	if _, ok := status["currentHash"]; ok {
+		t.Errorf("expected the current hash not to be written but got: %v", status["currentHash"])
+	}
+	audit, _ := status["audit"].(map[string]interface{})
+	if audit["hash"] != status["pendingHash"] || audit["reason"] != "WaitingForApproval" || audit["count"] != float64(1) {
+		t.Fatalf("expected the change to be recorded but got: %v", audit)
+	}
+
+	// Reconciling the same change doesn't count it again
+	rsp = run("a", next(rsp))
+	if count := statusOf(rsp)["audit"].(map[string]interface{})["count"]; count != float64(1) {
+		t.Errorf("expected the change to be counted once but got count %v", count)
+	}
+
+	// Another change is counted
+	rsp = run("b", next(rsp))
+	if count := statusOf(rsp)["audit"].(map[string]interface{})["count"]; count != float64(2) {
+		t.Errorf("expected a new change to be counted but got count %v", count)
+	}
+
+	// Approving the change moves the approved hash and clears the record
+	status = statusOf(rsp)
+	status["approved"] = true
+	approved, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+	rsp = run("b", string(approved))
+	status = statusOf(rsp)
+	if status["currentHash"] == nil || status["currentHash"] == "" {
+		t.Errorf("expected the approved hash to be written but got: %v", status)
+	}
+	audit = status["audit"].(map[string]interface{})
+	if audit["hash"] != "" || audit["count"] != float64(2) || audit["source"] != "status" {
+		t.Errorf("expected the record to be cleared, the count kept and the source recorded but got: %v", audit)
+	}
+	if c := condition(rsp, "ApprovalWouldBeRequired"); c.GetStatus() != fnv1.Status_STATUS_CONDITION_FALSE {
+		t.Errorf("expected the ApprovalWouldBeRequired condition to be false but got: %v", c)
+	}
+	if c := condition(rsp, approvalRequiredCondition); !strings.Contains(c.GetMessage(), "Approval source: status (status.approved)") {
+		t.Errorf("expected the ApprovalRequired condition to name the approval source but got: %v", c)
+	}
+}
+
+func TestFunction_EnforcementOverride(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	cases := map[string]struct {
+		annotation string
+		wantFatal  bool
+		wantType   string
+	}{
+		"NoOverride": {
+			wantFatal: true,
+			wantType:  approvalRequiredCondition,
+		},
+		"AllowedOverride": {
+			annotation: "Warning",
+			wantType:   "ApprovalWouldBeRequired",
+		},
+		"DisallowedOverride": {
+			annotation: "Hold",
+			wantFatal:  true,
+			wantType:   approvalRequiredCondition,
+		},
+		"UnknownOverride": {
+			annotation: "Ignore",
+			wantFatal:  true,
+			wantType:   approvalRequiredCondition,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			annotations := `{}`
+			if tc.annotation != "" {
+				annotations = `{"` + enforcementAnnotation + `": "` + tc.annotation + `"}`
+			}
+			xr := `{
+				"apiVersion": "example.org/v1",
+				"kind": "XR",
+				"metadata": {
+					"name": "test-xr",
+					"annotations": ` + annotations + `
+				},
+				"spec": {
+					"resources": {"value": "changed"}
+				},
+				"status": {}
+			}`
+
+			req := &fnv1.RunFunctionRequest{
+				Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+				Input: resource.MustStructJSON(`{
+					"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+					"kind": "Input",
+					"dataField": "spec.resources",
+					"enforcementOverrides": ["Warning"]
+				}`),
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				},
+				Desired: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+				},
+			}
+
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			hasFatal, hasIgnored := false, false
+			for _, r := range rsp.GetResults() {
+				if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+					hasFatal = true
+				}
+				if r.GetSeverity() == fnv1.Severity_SEVERITY_WARNING && strings.Contains(r.GetMessage(), "is not an allowed override") {
+					hasIgnored = true
+				}
+			}
+			if hasFatal != tc.wantFatal {
+				t.Errorf("expected fatal result %v but got: %v", tc.wantFatal, rsp.GetResults())
+			}
+			if wantIgnored := tc.annotation != "" && tc.wantFatal; hasIgnored != wantIgnored {
+				t.Errorf("expected an ignored override warning %v but got: %v", wantIgnored, rsp.GetResults())
+			}
+
+			hasCondition := false
+			for _, c := range rsp.GetConditions() {
+				if c.GetType() == tc.wantType {
+					hasCondition = true
+				}
+			}
+			if !hasCondition {
+				t.Errorf("expected a %s condition but got: %v", tc.wantType, rsp.GetConditions())
+			}
+		})
+	}
+}
+
+func TestFunction_Quorum(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	run := func(status string) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": {"value": "changed"}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"quorum": {
+					"approvals": 2,
+					"groups": [{"name": "security", "approvals": 1}]
+				}
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	statusOf := func(rsp *fnv1.RunFunctionResponse) map[string]interface{} {
+		return rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	}
+	withApprovals := func(status map[string]interface{}, approvals ...interface{}) string {
+		status["approved"] = approvals
+		b, err := json.Marshal(status)
+		if err != nil {
+			t.Fatalf("cannot marshal status: %v", err)
+		}
+		return string(b)
+	}
+
+	rsp := run(`{}`)
+	status := statusOf(rsp)
+	pendingHash, _ := status["pendingHash"].(string)
+	if pendingHash == "" {
+		t.Fatalf("expected a pending hash but got: %v", status)
+	}
+
+	alice := map[string]interface{}{"name": "alice", "group": "security", "hash": pendingHash, "timestamp": "2026-10-16T10:00:00Z"}
+	bob := map[string]interface{}{"name": "bob", "group": "dev", "hash": pendingHash, "timestamp": "2026-10-16T11:00:00Z"}
+
+	// The same approver approving twice only counts once
+	rsp = run(withApprovals(status, alice, alice))
+	var condition *fnv1.Condition
+	for _, c := range rsp.GetConditions() {
+		if c.GetType() == approvalRequiredCondition {
+			condition = c
+		}
+	}
+	if condition.GetReason() != "WaitingForQuorum" || !strings.Contains(condition.GetMessage(), "1/2 approvals collected, 1/1 from group security") {
+		t.Errorf("expected the condition to show the quorum's progress but got: %v", condition)
+	}
+	if _, ok := statusOf(rsp)["currentHash"]; ok {
+		t.Fatalf("expected the change not to be approved without a quorum but got: %v", statusOf(rsp))
+	}
+
+	// Records of another change are stale, and the condition names the hash
+	// they approve rather than claiming they were withdrawn
+	const otherHash = "sha256:v1:0000000000000000000000000000000000000000000000000000000000000000"
+	carol := map[string]interface{}{"name": "carol", "group": "security", "hash": otherHash}
+	rsp = run(withApprovals(statusOf(rsp), carol))
+	for _, c := range rsp.GetConditions() {
+		if c.GetType() == approvalRequiredCondition {
+			condition = c
+		}
+	}
+	wantStale := "Approver records in status.approved approve hash " + otherHash + ", not the pending hash " + pendingHash
+	if condition.GetReason() != "StaleApproval" || !strings.Contains(condition.GetMessage(), wantStale) || strings.Contains(condition.GetMessage(), "withdrawn") {
+		t.Errorf("expected the condition to name the approved and the pending hash but got: %v", condition)
+	}
+
+	rsp = run(withApprovals(statusOf(rsp), alice, bob))
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			t.Fatalf("expected the quorum to approve the change but got: %v", r.GetMessage())
+		}
+	}
+	status = statusOf(rsp)
+	if status["currentHash"] != pendingHash {
+		t.Errorf("expected the approved hash %s but got: %v", pendingHash, status["currentHash"])
+	}
+	if !reflect.DeepEqual(status["approved"], []interface{}{}) {
+		t.Errorf("expected the approvals to be cleared but got: %v", status["approved"])
+	}
+}
+
+func TestFunction_ApproverDirectory(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	directory := &fnv1.Resources{Items: []*fnv1.Resource{{Resource: resource.MustStructJSON(`{
+		"apiVersion": "v1",
+		"kind": "ConfigMap",
+		"metadata": {"name": "approvers", "namespace": "crossplane-system"},
+		"data": {"alice": "security"}
+	}`)}}}
+
+	run := func(status string, required map[string]*fnv1.Resources) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": {
+				"resources": {"value": "changed"}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"approverDirectory": {"name": "approvers", "namespace": "crossplane-system"}
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			RequiredResources: required,
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	rsp := run(`{}`, nil)
+	sel := rsp.GetRequirements().GetResources()["approver-directory"]
+	if sel.GetKind() != "ConfigMap" || sel.GetMatchName() != "approvers" || sel.GetNamespace() != "crossplane-system" {
+		t.Fatalf("expected the approver directory to be required but got: %v", rsp.GetRequirements())
+	}
+	pendingHash, _ := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})["pendingHash"].(string)
+
+	approvedBy := func(name string) string {
+		return `{"pendingHash": "` + pendingHash + `", "approved": [{"name": "` + name + `", "group": "security", "hash": "` + pendingHash + `"}]}`
+	}
+	currentHash := func(rsp *fnv1.RunFunctionResponse) interface{} {
+		return rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})["currentHash"]
+	}
+
+	cases := map[string]struct {
+		status       string
+		required     map[string]*fnv1.Resources
+		wantApproved bool
+		wantReason   string
+	}{
+		"DirectoryNotFetched": {
+			status:     approvedBy("alice"),
+			wantReason: "WaitingForApproval",
+		},
+		"UnlistedApprover": {
+			status:     approvedBy("mallory"),
+			required:   map[string]*fnv1.Resources{"approver-directory": directory},
+			wantReason: "ApproverRejected",
+		},
+		"BooleanApproval": {
+			status:     `{"pendingHash": "` + pendingHash + `", "approved": true}`,
+			required:   map[string]*fnv1.Resources{"approver-directory": directory},
+			wantReason: "WaitingForApproval",
+		},
+		"ListedApprover": {
+			status:       approvedBy("alice"),
+			required:     map[string]*fnv1.Resources{"approver-directory": directory},
+			wantApproved: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := run(tc.status, tc.required)
+			if approved := currentHash(rsp) == pendingHash; approved != tc.wantApproved {
+				t.Fatalf("expected approved %v but got current hash %v", tc.wantApproved, currentHash(rsp))
+			}
+			if tc.wantApproved {
+				return
+			}
+			reason := ""
+			for _, c := range rsp.GetConditions() {
+				if c.GetType() == approvalRequiredCondition {
+					reason = c.GetReason()
+				}
+			}
+			if reason != tc.wantReason {
+				t.Errorf("expected reason %s but got %s", tc.wantReason, reason)
+			}
+		})
+	}
+}
+
+func TestFunction_ApprovalSignatures(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "security"), encodePublicKey(t, public), 0o600); err != nil {
+		t.Fatalf("cannot write key: %v", err)
+	}
+
+	const uid = "5f8d2c1e-0000-4000-8000-000000000001"
+	run := func(status string) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr",
+				"uid": "` + uid + `"
+			},
+			"spec": {
+				"resources": {"value": "changed"}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"approvalSignatures": {"directory": "` + dir + `", "signers": [{"keyId": "security", "name": "alice"}]}
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	statusOf := func(rsp *fnv1.RunFunctionResponse) map[string]interface{} {
+		return rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	}
+	pendingHash, _ := statusOf(run(`{}`))["pendingHash"].(string)
+
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, signedPayload(uid, pendingHash, expires, "alice", "")))
+	approvedBy := func(signature string) string {
+		return `{"pendingHash": "` + pendingHash + `", "approved": [{"name": "alice", "hash": "` + pendingHash + `", "keyId": "security", "expires": "` + expires + `", "signature": "` + signature + `"}]}`
+	}
+
+	// Write access to the status alone isn't enough to approve
+	rsp := run(approvedBy(""))
+	reason := ""
+	for _, c := range rsp.GetConditions() {
+		if c.GetType() == approvalRequiredCondition {
+			reason = c.GetReason()
+		}
+	}
+	if reason != "ApproverRejected" {
+		t.Errorf("expected an unsigned approval to be rejected but got reason %s", reason)
+	}
+	if _, ok := statusOf(rsp)["currentHash"]; ok {
+		t.Fatalf("expected an unsigned approval not to approve the change")
+	}
+
+	rsp = run(approvedBy(signature))
+	if got := statusOf(rsp)["currentHash"]; got != pendingHash {
+		t.Errorf("expected a signed approval to approve %s but got current hash %v", pendingHash, got)
+	}
+}
+
+func TestFunction_AnnotationApproval(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	const annotation = "approve.fn.crossplane.io/approved"
+	run := func(value, approval, status string) *fnv1.RunFunctionResponse {
+		annotations := `{}`
+		if approval != "" {
+			annotations = `{"` + annotation + `": "` + approval + `"}`
+		}
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr",
+				"annotations": ` + annotations + `
+			},
+			"spec": {
+				"resources": {"value": "` + value + `"}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"approvalField": "metadata.annotations[\"` + annotation + `\"]"
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		for _, r := range rsp.GetResults() {
+			if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL && !strings.Contains(r.GetMessage(), "Approval required") {
+				t.Fatalf("expected no error but got: %v", r.GetMessage())
+			}
+		}
+		return rsp
+	}
+
+	statusOf := func(rsp *fnv1.RunFunctionResponse) map[string]interface{} {
+		return rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	}
+	next := func(rsp *fnv1.RunFunctionResponse) string {
+		b, err := json.Marshal(statusOf(rsp))
+		if err != nil {
+			t.Fatalf("cannot marshal status: %v", err)
+		}
+		return string(b)
+	}
+
+	rsp := run("a", "", `{}`)
+	first, _ := statusOf(rsp)["pendingHash"].(string)
+
+	// An annotation of true approves the pending change, and is recorded as
+	// used since it can't be reset
+	rsp = run("a", "true", next(rsp))
+	status := statusOf(rsp)
+	if status["currentHash"] != first || status["consumedApproval"] != first {
+		t.Fatalf("expected the annotation to approve %s but got: %v", first, status)
+	}
+	if _, ok := status["metadata"]; ok {
+		t.Errorf("expected the approval not to be written to status but got: %v", status)
+	}
+	hasSource := false
+	for _, c := range rsp.GetConditions() {
+		if c.GetType() == approvalRequiredCondition {
+			hasSource = strings.Contains(c.GetMessage(), `Approval source: annotation (metadata.annotations["`+annotation+`"])`)
+		}
+	}
+	if !hasSource {
+		t.Errorf("expected the condition to name the approval source but got: %v", rsp.GetConditions())
+	}
+
+	// The same annotation doesn't approve the next change
+	rsp = run("b", "true", next(rsp))
+	status = statusOf(rsp)
+	second, _ := status["pendingHash"].(string)
+	if status["currentHash"] != first {
+		t.Fatalf("expected a used approval not to approve the next change but got: %v", status)
+	}
+	hasUsed := false
+	for _, c := range rsp.GetConditions() {
+		if c.GetType() == approvalRequiredCondition {
+			hasUsed = strings.Contains(c.GetMessage(), "was already used to approve hash "+first)
+		}
+	}
+	if !hasUsed {
+		t.Errorf("expected the condition to explain the approval was used but got: %v", rsp.GetConditions())
+	}
+
+	// Removing the annotation clears the record, so it can approve again
+	rsp = run("b", "", next(rsp))
+	if got := statusOf(rsp)["consumedApproval"]; got != "" {
+		t.Fatalf("expected the used approval to be cleared but got: %v", got)
+	}
+	rsp = run("b", "true", next(rsp))
+	if got := statusOf(rsp)["currentHash"]; got != second {
+		t.Errorf("expected the annotation to approve %s but got: %v", second, got)
+	}
+
+	// A hash in the annotation approves only that change
+	rsp = run("c", "", next(rsp))
+	third, _ := statusOf(rsp)["pendingHash"].(string)
+	rsp = run("c", parseHash(third).Digest[:16], next(rsp))
+	if got := statusOf(rsp)["currentHash"]; got != third {
+		t.Errorf("expected the hash annotation to approve %s but got: %v", third, got)
+	}
+
+	// An annotation of true given for a pending hash that was replaced before
+	// it was seen doesn't approve the new pending hash, on this run or later
+	rsp = run("d", "", next(rsp))
+	fourth, _ := statusOf(rsp)["pendingHash"].(string)
+	rsp = run("e", "true", next(rsp))
+	status = statusOf(rsp)
+	fifth, _ := status["pendingHash"].(string)
+	if status["currentHash"] != third || status["consumedApproval"] != fourth {
+		t.Fatalf("expected the stale approval to be recorded for %s but got: %v", fourth, status)
+	}
+	rsp = run("e", "true", next(rsp))
+	if got := statusOf(rsp)["currentHash"]; got != third {
+		t.Fatalf("expected a stale approval not to approve %s but got: %v", fifth, got)
+	}
+	hasStale := false
+	for _, c := range rsp.GetConditions() {
+		if c.GetType() == approvalRequiredCondition {
+			hasStale = strings.Contains(c.GetMessage(), "was given for pending hash "+fourth)
+		}
+	}
+	if !hasStale {
+		t.Errorf("expected the condition to explain the approval is stale but got: %v", rsp.GetConditions())
+	}
+	rsp = run("e", "", next(rsp))
+	rsp = run("e", "true", next(rsp))
+	if got := statusOf(rsp)["currentHash"]; got != fifth {
+		t.Errorf("expected the annotation to approve %s but got: %v", fifth, got)
+	}
+
+	// Only approvals in status predate pending hashes, so an annotation of
+	// true doesn't approve a change whose pending hash wasn't published
+	status = statusOf(rsp)
+	delete(status, "pendingHash")
+	delete(status, "consumedApproval")
+	unpublished, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("cannot marshal status: %v", err)
+	}
+	rsp = run("f", "true", string(unpublished))
+	status = statusOf(rsp)
+	if status["currentHash"] != fifth || status["consumedApproval"] != status["pendingHash"] {
+		t.Errorf("expected an annotation given before the pending hash was published to be withdrawn but got: %v", status)
+	}
+}
+
+func TestFunction_SpecApprovalNotHashed(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	run := func(approval, status string) *fnv1.RunFunctionResponse {
+		spec := `{"resources": {"value": "a"}}`
+		if approval != "" {
+			spec = `{"resources": {"value": "a"}, "approval": ` + approval + `}`
+		}
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr"
+			},
+			"spec": ` + spec + `,
+			"status": ` + status + `
+		}`
+
+		rsp, err := f.RunFunction(context.Background(), &fnv1.RunFunctionRequest{
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec",
+				"approvalField": "spec.approval"
+			}`),
+			Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)}},
+			Desired:  &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)}},
+		})
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	statusOf := func(rsp *fnv1.RunFunctionResponse) map[string]interface{} {
+		return rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	}
+	next := func(rsp *fnv1.RunFunctionResponse) string {
+		b, err := json.Marshal(statusOf(rsp))
+		if err != nil {
+			t.Fatalf("cannot marshal status: %v", err)
+		}
+		return string(b)
+	}
+
+	// The approval field is within the watched spec, but giving the approval
+	// doesn't change the hash it approves
+	cases := map[string]func(pendingHash string) string{
+		"Boolean": func(string) string { return `true` },
+		"Hash":    func(pendingHash string) string { return `"` + pendingHash + `"` },
+	}
+	for name, approval := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := run("", `{}`)
+			pendingHash, _ := statusOf(rsp)["pendingHash"].(string)
+
+			rsp = run(approval(pendingHash), next(rsp))
+			if got := statusOf(rsp)["currentHash"]; got != pendingHash {
+				t.Errorf("expected the approval to approve %s but got: %v", pendingHash, got)
+			}
+		})
+	}
+}
+
+func TestFunction_ApprovalObjects(t *testing.T) {
+	f := &Function{
+		log: logging.NewNopLogger(),
+	}
+
+	run := func(status string, required map[string]*fnv1.Resources) *fnv1.RunFunctionResponse {
+		xr := `{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {
+				"name": "test-xr",
+				"uid": "xr-uid"
+			},
+			"spec": {
+				"resources": {"value": "changed"}
+			},
+			"status": ` + status + `
+		}`
+
+		req := &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "fn-approval"},
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "approve.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"dataField": "spec.resources",
+				"approvalObjects": {"namespace": "approvals"}
+			}`),
+			Observed: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			Desired: &fnv1.State{
+				Composite: &fnv1.Resource{Resource: resource.MustStructJSON(xr)},
+			},
+			RequiredResources: required,
+		}
+
+		rsp, err := f.RunFunction(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		return rsp
+	}
+
+	rsp := run(`{}`, nil)
+	sel := rsp.GetRequirements().GetResources()["approval-objects"]
+	if sel.GetKind() != "ConfigMap" || sel.GetNamespace() != "approvals" || sel.GetMatchLabels().GetLabels()[xrUIDLabel] != "xr-uid" {
+		t.Fatalf("expected approval objects to be required but got: %v", rsp.GetRequirements())
+	}
+	pendingHash, _ := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})["pendingHash"].(string)
+
+	approval := func(hash string) map[string]*fnv1.Resources {
+		return map[string]*fnv1.Resources{"approval-objects": {Items: []*fnv1.Resource{{Resource: resource.MustStructJSON(`{
+			"apiVersion": "v1",
+			"kind": "ConfigMap",
+			"metadata": {"name": "alice", "namespace": "approvals", "labels": {"` + xrUIDLabel + `": "xr-uid"}},
+			"data": {"hash": "` + hash + `"}
+		}`)}}}}
+	}
+	status := `{"pendingHash": "` + pendingHash + `"}`
+
+	cases := map[string]struct {
+		status       string
+		required     map[string]*fnv1.Resources
+		wantApproved bool
+		wantReason   string
+		wantMessage  string
+	}{
+		"ObjectsNotFetched": {
+			status:     status,
+			wantReason: "WaitingForApproval",
+		},
+		"NoObjects": {
+			status:     status,
+			required:   map[string]*fnv1.Resources{"approval-objects": {}},
+			wantReason: "WaitingForApproval",
+		},
+		"ApprovalFieldIgnored": {
+			status:     `{"pendingHash": "` + pendingHash + `", "approved": true}`,
+			required:   map[string]*fnv1.Resources{"approval-objects": {}},
+			wantReason: "WaitingForApproval",
+		},
+		"StaleObject": {
+			status:      status,
+			required:    approval("0000000000000000000000000000000000000000000000000000000000000000"),
+			wantReason:  "StaleApproval",
+			wantMessage: "Approval objects of kind ConfigMap approve hash 0000000000000000000000000000000000000000000000000000000000000000, not the pending hash " + pendingHash,
+		},
+		"ApprovingObject": {
+			status:       status,
+			required:     approval(pendingHash),
+			wantApproved: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := run(tc.status, tc.required)
+			xrStatus := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+			if approved := xrStatus["currentHash"] == pendingHash; approved != tc.wantApproved {
+				t.Fatalf("expected approved %v but got current hash %v", tc.wantApproved, xrStatus["currentHash"])
+			}
+			if tc.wantApproved {
+				if _, ok := xrStatus["approved"]; ok {
+					t.Errorf("expected the approval field to be left alone but got %v", xrStatus["approved"])
+				}
+				return
+			}
+			reason, message := "", ""
+			for _, c := range rsp.GetConditions() {
+				if c.GetType() == approvalRequiredCondition {
+					reason, message = c.GetReason(), c.GetMessage()
+				}
+			}
+			if reason != tc.wantReason {
+				t.Errorf("expected reason %s but got %s", tc.wantReason, reason)
+			}
+			if !strings.Contains(message, tc.wantMessage) {
+				t.Errorf("expected the condition message to contain %q but got: %s", tc.wantMessage, message)
+			}
+		})
+	}
+}
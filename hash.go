@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// hashVersion identifies how watched data is encoded before it is hashed. It
+// must change whenever the encoding changes, so that hashes produced by an
+// older encoding can be recognised and upgraded.
+const hashVersion = "v1"
+
+// hashFuncs are the supported hash algorithms
+var hashFuncs = map[string]func() hash.Hash{
+	v1beta1.HashAlgorithmSHA256: sha256.New,
+	v1beta1.HashAlgorithmSHA512: sha512.New,
+	v1beta1.HashAlgorithmXXHash: func() hash.Hash { return xxhash.New() },
+}
+
+// storedHash is a hash as stored in the XR status, in the form
+// "<algorithm>:<version>:<digest>". A sealed hash has an HMAC of that form
+// appended, i.e. "<algorithm>:<version>:<digest>:<mac>".
+type storedHash struct {
+	// Algorithm is the hash algorithm that produced the digest
+	Algorithm string
+
+	// Version is the version of the encoding that was hashed
+	Version string
+
+	// Digest is the hex encoded digest
+	Digest string
+
+	// MAC is the hex encoded HMAC that seals the hash, if it is sealed
+	MAC string
+
+	// Legacy is true if the hash was stored as a bare digest, before hashes
+	// recorded how they were produced
+	Legacy bool
+}
+
+// parseHash parses a stored hash. A bare digest is a legacy hash, which was
+// always a SHA-256 digest of the same encoding as version v1.
+func parseHash(s string) storedHash {
+	parts := strings.SplitN(s, ":", 4)
+	switch len(parts) {
+	case 3:
+		return storedHash{Algorithm: parts[0], Version: parts[1], Digest: parts[2]}
+	case 4:
+		return storedHash{Algorithm: parts[0], Version: parts[1], Digest: parts[2], MAC: parts[3]}
+	default:
+		return storedHash{Algorithm: v1beta1.HashAlgorithmSHA256, Version: "v1", Digest: s, Legacy: true}
+	}
+}
+
+// String returns the hash in the form it is stored in
+func (h storedHash) String() string {
+	s := h.Algorithm + ":" + h.Version + ":" + h.Digest
+	if h.MAC != "" {
+		s += ":" + h.MAC
+	}
+	return s
+}
+
+// sameHash returns true if both hashes are the same digest of the same
+// encoding, regardless of whether either is a legacy or sealed hash
+func sameHash(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ha, hb := parseHash(a), parseHash(b)
+	return ha.Algorithm == hb.Algorithm && ha.Version == hb.Version && ha.Digest == hb.Digest
+}
+
+// digestData returns the hex encoded digest of the JSON encoding of the data
+func digestData(algorithm string, data interface{}) (string, error) {
+	newHash, ok := hashFuncs[algorithm]
+	if !ok {
+		return "", errors.Errorf("unknown hash algorithm %q", algorithm)
+	}
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot marshal data to JSON")
+	}
+
+	h := newHash()
+	h.Write(jsonData)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sealHash returns the hash sealed with an HMAC of it, keyed with the supplied
+// key. The HMAC uses the algorithm that produced the hash.
+func sealHash(hash string, key []byte) (string, error) {
+	h := parseHash(hash)
+	h.MAC = ""
+
+	mac, err := macHash(h, key)
+	if err != nil {
+		return "", err
+	}
+
+	h.MAC = mac
+	return h.String(), nil
+}
+
+// verifySeal returns the hash without its seal, and whether it was sealed
+// with the supplied key
+func verifySeal(hash string, key []byte) (string, bool) {
+	h := parseHash(hash)
+	if h.Legacy || h.MAC == "" {
+		return hash, false
+	}
+
+	sealed := h.MAC
+	h.MAC = ""
+
+	mac, err := macHash(h, key)
+	if err != nil {
+		return h.String(), false
+	}
+
+	return h.String(), hmac.Equal([]byte(mac), []byte(sealed))
+}
+
+// macHash returns the hex encoded HMAC of an unsealed hash
+func macHash(h storedHash, key []byte) (string, error) {
+	newHash, ok := hashFuncs[h.Algorithm]
+	if !ok || h.Algorithm == v1beta1.HashAlgorithmXXHash {
+		return "", errors.Errorf("cannot seal a hash with algorithm %q", h.Algorithm)
+	}
+
+	m := hmac.New(newHash, key)
+	m.Write([]byte(h.String()))
+	return hex.EncodeToString(m.Sum(nil)), nil
+}
+
+// hashSettings are the settings that shape the watched data before it is
+// hashed. They are recorded next to the approved hash, so the hash can still
+// be reproduced after they change.
+type hashSettings struct {
+	// IgnorePaths are the paths stripped from the XR
+	IgnorePaths []string `json:"ignorePaths,omitempty"`
+
+	// ResourceIgnorePaths are the paths stripped from desired composed
+	// resources
+	ResourceIgnorePaths []string `json:"resourceIgnorePaths,omitempty"`
+
+	// Normalization is how the data was canonicalized
+	Normalization *v1beta1.Normalization `json:"normalization,omitempty"`
+}
+
+// recordedHashSettings are hash settings as recorded in the XR status. If a
+// hash key is configured they are sealed to the approved hash with an HMAC,
+// since settings that strip a changed field would otherwise reproduce an old
+// approved hash.
+type recordedHashSettings struct {
+	hashSettings
+
+	// MAC is the hex encoded HMAC that seals the settings, if they are sealed
+	MAC string `json:"mac,omitempty"`
+}
+
+// gateHashSettings returns the settings the gate hashes the watched data with
+func gateHashSettings(g *v1beta1.Gate) hashSettings {
+	s := hashSettings{IgnorePaths: g.IgnorePaths, Normalization: g.Normalization}
+	if g.DesiredResources != nil {
+		s.ResourceIgnorePaths = g.DesiredResources.IgnorePaths
+	}
+	return s
+}
+
+// reshapes returns true if the settings strip or canonicalize any of the
+// watched data, so that it differs from the data in the XR
+func (s hashSettings) reshapes() bool {
+	return len(s.IgnorePaths) > 0 || len(s.ResourceIgnorePaths) > 0 || s.Normalization != nil
+}
+
+// withHashSettings returns a copy of the gate that hashes the watched data
+// with the supplied settings
+func withHashSettings(g *v1beta1.Gate, s hashSettings) *v1beta1.Gate {
+	out := *g
+	out.IgnorePaths = s.IgnorePaths
+	out.Normalization = s.Normalization
+	if g.DesiredResources != nil {
+		resources := *g.DesiredResources
+		resources.IgnorePaths = s.ResourceIgnorePaths
+		out.DesiredResources = &resources
+	}
+	return &out
+}
+
+// macHashSettings returns the hex encoded HMAC of the settings the supplied
+// hash was produced with
+func macHashSettings(s hashSettings, hash string, key []byte) (string, error) {
+	mac, err := macBoundToHash(s, hash, key)
+	return mac, errors.Wrap(err, "cannot seal hash settings")
+}
+
+// macBoundToHash returns the hex encoded HMAC of the JSON encoding of a value
+// that was recorded along with the supplied hash, so it can't be replayed with
+// another hash. The HMAC uses the algorithm that produced the hash.
+func macBoundToHash(v interface{}, hash string, key []byte) (string, error) {
+	h := parseHash(hash)
+	h.MAC = ""
+
+	newHash, ok := hashFuncs[h.Algorithm]
+	if !ok || h.Algorithm == v1beta1.HashAlgorithmXXHash {
+		return "", errors.Errorf("cannot seal a value with a hash of algorithm %q", h.Algorithm)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot marshal to JSON")
+	}
+
+	m := hmac.New(newHash, key)
+	m.Write([]byte(h.String() + "\n"))
+	m.Write(data)
+	return hex.EncodeToString(m.Sum(nil)), nil
+}
+
+// verifyHashSettings returns true if the recorded settings were sealed to the
+// supplied hash with the supplied key
+func verifyHashSettings(r recordedHashSettings, hash string, key []byte) bool {
+	if r.MAC == "" {
+		return false
+	}
+
+	mac, err := macHashSettings(r.hashSettings, hash, key)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(r.MAC))
+}
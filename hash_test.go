@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+)
+
+func TestParseHash(t *testing.T) {
+	cases := map[string]struct {
+		hash string
+		want storedHash
+	}{
+		"Stored": {
+			hash: "sha512:v1:abcdef",
+			want: storedHash{Algorithm: "sha512", Version: "v1", Digest: "abcdef"},
+		},
+		"Legacy": {
+			hash: "abcdef",
+			want: storedHash{Algorithm: "sha256", Version: "v1", Digest: "abcdef", Legacy: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := parseHash(tc.hash); got != tc.want {
+				t.Errorf("parseHash(%q): want %+v, got %+v", tc.hash, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchesHash(t *testing.T) {
+	const (
+		hash  = "sha256:v1:a07bdeee84158b7c1b565b1f65ead2f1ff88d0d111b622907e953f19174a1cfb"
+		other = "sha256:v1:a07bdeee84158b7c000000000000000000000000000000000000000000000000"
+	)
+
+	cases := map[string]struct {
+		value   string
+		other   string
+		pending string
+		want    bool
+	}{
+		"Stored":            {value: hash, want: true},
+		"Digest":            {value: "a07bdeee84158b7c1b565b1f65ead2f1ff88d0d111b622907e953f19174a1cfb", want: true},
+		"DigestPrefix":      {value: "a07bdeee84158b7c", pending: hash, want: true},
+		"ShortPrefix":       {value: "a07bdeee84158b7", pending: hash, want: false},
+		"AmbiguousPrefix":   {value: "a07bdeee84158b7c", other: other, pending: hash, want: false},
+		"LongerPrefix":      {value: "a07bdeee84158b7c1b", other: other, pending: hash, want: true},
+		"PrefixNotPending":  {value: "a07bdeee84158b7c", pending: other, want: false},
+		"PrefixNonePending": {value: "a07bdeee84158b7c", want: false},
+		"DigestNotPending":  {value: "a07bdeee84158b7c1b565b1f65ead2f1ff88d0d111b622907e953f19174a1cfb", pending: other, want: true},
+		"SchemePrefix":      {value: "sha256:v1:a07b", pending: hash, want: false},
+		"OtherAlgorithm":    {value: "sha512:v1:a07bdeee84158b7c1b565b1f65ead2f1ff88d0d111b622907e953f19174a1cfb", pending: hash, want: false},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := matchesHash(tc.value, hash, tc.other, tc.pending); got != tc.want {
+				t.Errorf("matchesHash(%q): want %t, got %t", tc.value, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSealHash(t *testing.T) {
+	const hash = "sha256:v1:e02c6d35c585a43c62dc2ae14a5385b8a86168b36be7a0d985c0c09afca4ffbe"
+
+	sealed, err := sealHash(hash, []byte("secret"))
+	if err != nil {
+		t.Fatalf("sealHash(...): unexpected error: %v", err)
+	}
+
+	if unsealed, valid := verifySeal(sealed, []byte("secret")); !valid || unsealed != hash {
+		t.Errorf("verifySeal(...): want %s and a valid seal, got %s and %t", hash, unsealed, valid)
+	}
+
+	if _, valid := verifySeal(sealed, []byte("another secret")); valid {
+		t.Error("verifySeal(...): expected a seal made with another key to be invalid")
+	}
+
+	if _, valid := verifySeal(hash, []byte("secret")); valid {
+		t.Error("verifySeal(...): expected an unsealed hash to be invalid")
+	}
+
+	if _, err := sealHash("xxhash:v1:0123456789abcdef", []byte("secret")); err == nil {
+		t.Error("sealHash(...): expected an error sealing an xxhash hash but got none")
+	}
+}
+
+func TestSealHashSettings(t *testing.T) {
+	const (
+		hash  = "sha256:v1:e02c6d35c585a43c62dc2ae14a5385b8a86168b36be7a0d985c0c09afca4ffbe"
+		other = "sha256:v1:a07bdeee84158b7c1b565b1f65ead2f1ff88d0d111b622907e953f19174a1cfb"
+	)
+
+	s := hashSettings{IgnorePaths: []string{"spec.resources.tags"}}
+	mac, err := macHashSettings(s, hash, []byte("secret"))
+	if err != nil {
+		t.Fatalf("macHashSettings(...): unexpected error: %v", err)
+	}
+	recorded := recordedHashSettings{hashSettings: s, MAC: mac}
+
+	if !verifyHashSettings(recorded, hash, []byte("secret")) {
+		t.Error("verifyHashSettings(...): expected settings sealed to the hash to be valid")
+	}
+
+	if verifyHashSettings(recorded, other, []byte("secret")) {
+		t.Error("verifyHashSettings(...): expected settings sealed to another hash to be invalid")
+	}
+
+	// Ignoring more fields could hide a change, so altered settings must not
+	// verify
+	altered := recorded
+	altered.IgnorePaths = []string{"spec.resources.tags", "spec.resources.size"}
+	if verifyHashSettings(altered, hash, []byte("secret")) {
+		t.Error("verifyHashSettings(...): expected altered settings to be invalid")
+	}
+
+	if verifyHashSettings(recordedHashSettings{hashSettings: s}, hash, []byte("secret")) {
+		t.Error("verifyHashSettings(...): expected unsealed settings to be invalid")
+	}
+}
+
+func TestHashSettingsReshapes(t *testing.T) {
+	cases := map[string]struct {
+		s    hashSettings
+		want bool
+	}{
+		"None":                {want: false},
+		"IgnorePaths":         {s: hashSettings{IgnorePaths: []string{"spec.tags"}}, want: true},
+		"ResourceIgnorePaths": {s: hashSettings{ResourceIgnorePaths: []string{"metadata.labels"}}, want: true},
+		"Normalization":       {s: hashSettings{Normalization: &v1beta1.Normalization{TrimStrings: true}}, want: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.s.reshapes(); got != tc.want {
+				t.Errorf("reshapes(): want %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"crypto/hmac"
+	"sort"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// defaultMaxApprovedResourcesSize is the largest rendering of approved
+// resources stored by default, in bytes after encoding
+const defaultMaxApprovedResourcesSize = 262144
+
+// holdsResources returns true if the gate holds back composed resources
+// rather than halting the pipeline
+func holdsResources(g *v1beta1.Gate) bool {
+	return *g.Enforcement == v1beta1.EnforcementHold || *g.Enforcement == v1beta1.EnforcementHoldChanged
+}
+
+// tracksResources returns true if the gate tracks the desired state of
+// composed resources, to hold back or pause them
+func tracksResources(g *v1beta1.Gate) bool {
+	return holdsResources(g) || *g.Enforcement == v1beta1.EnforcementPause
+}
+
+// desiredResources returns the desired composed resources rendered by earlier
+// steps, keyed by their name in the pipeline
+func desiredResources(req *fnv1.RunFunctionRequest) map[string]interface{} {
+	resources := make(map[string]interface{}, len(req.GetDesired().GetResources()))
+	for name, r := range req.GetDesired().GetResources() {
+		resources[name] = r.GetResource().AsMap()
+	}
+	return resources
+}
+
+// resourceHashes returns the hash of the desired state of every composed
+// resource, keyed by its name in the pipeline
+func (f *Function) resourceHashes(resources map[string]interface{}, g *v1beta1.Gate) map[string]string {
+	hashes := make(map[string]string, len(resources))
+	for name, r := range resources {
+		hashes[name] = f.calculateHash(r, g)
+	}
+	return hashes
+}
+
+// changedResources returns the desired composed resources that exist, but
+// whose desired state changed since the last approval, sorted. Resources that
+// don't exist yet aren't held back, since they can't be affected by a change.
+func changedResources(hashes, approved map[string]string, observed map[string]*fnv1.Resource) []string {
+	var changed []string
+	for name, hash := range hashes {
+		if _, exists := observed[name]; !exists {
+			continue
+		}
+		if approved[name] == "" || !sameHash(approved[name], hash) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// sealResourceHashes seals the hash of each composed resource to its name and
+// the approved hash, so that hashes copied into the status can't make changed
+// resources look approved
+func sealResourceHashes(hashes map[string]string, approvedHash string, key []byte) (map[string]string, error) {
+	sealed := make(map[string]string, len(hashes))
+	for name, hash := range hashes {
+		h := parseHash(hash)
+		mac, err := macResourceHash(name, h, approvedHash, key)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot seal resource hashes")
+		}
+		h.MAC = mac
+		sealed[name] = h.String()
+	}
+	return sealed, nil
+}
+
+// verifyResourceHashes returns true if the hash of every composed resource
+// was sealed to its name and the approved hash with the supplied key
+func verifyResourceHashes(hashes map[string]string, approvedHash string, key []byte) bool {
+	for name, hash := range hashes {
+		h := parseHash(hash)
+		if h.MAC == "" {
+			return false
+		}
+		mac, err := macResourceHash(name, h, approvedHash, key)
+		if err != nil || !hmac.Equal([]byte(mac), []byte(h.MAC)) {
+			return false
+		}
+	}
+	return true
+}
+
+// macResourceHash returns the hex encoded HMAC of a composed resource's hash
+// without its MAC
+func macResourceHash(name string, h storedHash, approvedHash string, key []byte) (string, error) {
+	h.MAC = ""
+	return macBoundToHash(map[string]string{"name": name, "hash": h.String()}, approvedHash, key)
+}
+
+// getApprovedResourceHashes returns the hashes of the desired state of each
+// composed resource at the last approval. If the gate has a hash key they must
+// be sealed to the approved hash with it. Otherwise none are returned, so that
+// every resource counts as changed.
+func (f *Function) getApprovedResourceHashes(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, state *approvalState, rsp *fnv1.RunFunctionResponse) (map[string]string, error) {
+	hashes, err := f.getHashes(req, *g.ResourceHashesField, rsp)
+	if err != nil || state.HashKey == nil || len(hashes) == 0 {
+		return hashes, err
+	}
+
+	if state.CurrentHash == "" || !verifyResourceHashes(hashes, state.CurrentHash, state.HashKey) {
+		f.log.Info("Approved resource hashes are not sealed with the hash key, treating every resource as changed", "gate", g.Name)
+		return nil, nil
+	}
+	return hashes, nil
+}
+
+// approvedResources is the rendering of the desired composed resources at the
+// last approval, as stored in the XR status
+type approvedResources struct {
+	// Hash is the approved hash the resources were rendered at
+	Hash string `json:"hash"`
+
+	// Resources are the desired composed resources, keyed by their name in
+	// the pipeline
+	Resources map[string]interface{} `json:"resources"`
+
+	// MAC is the hex encoded HMAC that seals the rendering to the hash, if
+	// the gate has a hash key
+	MAC string `json:"mac,omitempty"`
+}
+
+// encodeApprovedResources returns the rendering of the desired composed
+// resources approved with the supplied hash as it is stored in the XR status,
+// sealed with the key if there is one
+func encodeApprovedResources(resources map[string]interface{}, hash string, key []byte) (string, error) {
+	a := approvedResources{Hash: hash, Resources: resources}
+	if key != nil {
+		mac, err := macBoundToHash(a, hash, key)
+		if err != nil {
+			return "", errors.Wrap(err, "cannot seal approved resources")
+		}
+		a.MAC = mac
+	}
+
+	encoded, err := encodeCompressed(a)
+	return encoded, errors.Wrap(err, "cannot encode approved resources")
+}
+
+// verifyApprovedResources returns true if the rendering was sealed to its hash
+// with the supplied key
+func verifyApprovedResources(a approvedResources, key []byte) bool {
+	if a.MAC == "" {
+		return false
+	}
+
+	sealed := a.MAC
+	a.MAC = ""
+	mac, err := macBoundToHash(a, a.Hash, key)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(sealed))
+}
+
+// trustedRendering returns the approved resources that may be composed while
+// a change is held. A resource is only composed if it is desired or exists,
+// and as the same kind of resource, so that a rendering written to the status
+// by someone else can't add resources to the composition.
+func trustedRendering(approved, desired map[string]interface{}, observed map[string]*fnv1.Resource) (map[string]interface{}, []string) {
+	trusted := make(map[string]interface{}, len(approved))
+	var dropped []string
+	for name, v := range approved {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			dropped = append(dropped, name)
+			continue
+		}
+
+		current, _ := desired[name].(map[string]interface{})
+		if o, exists := observed[name]; exists {
+			current = o.GetResource().AsMap()
+		}
+		if current == nil || obj["apiVersion"] != current["apiVersion"] || obj["kind"] != current["kind"] {
+			dropped = append(dropped, name)
+			continue
+		}
+		trusted[name] = obj
+	}
+	sort.Strings(dropped)
+	return trusted, dropped
+}
+
+// approvedRendering returns the resources to hold so that the desired
+// composed resources are the ones rendered at the last approval, and the new
+// resources to withhold. Resources that exist but weren't rendered at the
+// last approval are held at their observed state, since leaving them out
+// would delete them.
+func approvedRendering(desired, approved map[string]interface{}, observed map[string]*fnv1.Resource) ([]string, []string) {
+	var held, withheld []string
+	for name := range approved {
+		held = append(held, name)
+	}
+	for name := range desired {
+		if _, ok := approved[name]; ok {
+			continue
+		}
+		if _, exists := observed[name]; exists {
+			held = append(held, name)
+			continue
+		}
+		withheld = append(withheld, name)
+	}
+	sort.Strings(held)
+	sort.Strings(withheld)
+	return held, withheld
+}
+
+// heldState returns the desired state that keeps a composed resource as it
+// was observed: its identity, labels, annotations and spec, but none of the
+// fields set by the API server or the provider's status
+func heldState(observed map[string]interface{}) map[string]interface{} {
+	held := map[string]interface{}{
+		"apiVersion": observed["apiVersion"],
+		"kind":       observed["kind"],
+	}
+
+	if metadata, ok := observed["metadata"].(map[string]interface{}); ok {
+		m := make(map[string]interface{})
+		for _, k := range []string{"name", "namespace", "labels", "annotations"} {
+			if v, ok := metadata[k]; ok {
+				m[k] = v
+			}
+		}
+		held["metadata"] = m
+	}
+
+	if spec, ok := observed["spec"]; ok {
+		held["spec"] = spec
+	}
+	return held
+}
+
+// getApprovedResources returns the desired composed resources as they were
+// rendered at the last approval, or nil if there is no usable rendering of the
+// resources approved with the current hash. If the gate has a hash key the
+// rendering must be sealed with it.
+func (f *Function) getApprovedResources(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, state *approvalState, rsp *fnv1.RunFunctionResponse) (map[string]interface{}, error) {
+	encoded, _, err := f.getStatusString(req, *g.ApprovedResourcesField, rsp)
+	if err != nil || encoded == "" || state.CurrentHash == "" {
+		return nil, err
+	}
+
+	// Held resources fall back to their observed state if the rendering
+	// can't be used
+	var a approvedResources
+	if err := decodeCompressed(encoded, &a); err != nil {
+		f.log.Info("Cannot decode approved resources", "gate", g.Name, "error", err)
+		return nil, nil
+	}
+
+	if !sameHash(a.Hash, state.CurrentHash) {
+		f.log.Info("Approved resources were rendered at another hash", "gate", g.Name, "renderedHash", a.Hash)
+		return nil, nil
+	}
+
+	if state.HashKey != nil && !verifyApprovedResources(a, state.HashKey) {
+		f.log.Info("Approved resources are not sealed with the hash key", "gate", g.Name)
+		return nil, nil
+	}
+
+	return a.Resources, nil
+}
+
+// holdResources holds back composed resources according to the gate's
+// enforcement mode. It returns the resources that are held at their approved
+// or observed state, and the new resources that are withheld until the change
+// is approved.
+func (f *Function) holdResources(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse, state *approvalState) ([]string, []string, error) {
+	approved, err := f.getApprovedResources(req, g, state, rsp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	observed := req.GetObserved().GetResources()
+	approved, dropped := trustedRendering(approved, state.DesiredResources, observed)
+	if len(dropped) > 0 {
+		f.log.Info("Not holding approved resources that are neither desired nor observed as the same kind", "gate", g.Name, "resources", dropped)
+	}
+	var held, withheld []string
+	switch *g.Enforcement {
+	case v1beta1.EnforcementHold:
+		held, withheld = approvedRendering(state.DesiredResources, approved, observed)
+	case v1beta1.EnforcementHoldChanged:
+		approvedHashes, err := f.getApprovedResourceHashes(req, g, state, rsp)
+		if err != nil {
+			return nil, nil, err
+		}
+		held = changedResources(state.ResourceHashes, approvedHashes, observed)
+	}
+
+	if len(held) == 0 && len(withheld) == 0 {
+		return nil, nil, nil
+	}
+
+	resources := writableResources(req, rsp)
+	for _, name := range held {
+		obj, ok := approved[name].(map[string]interface{})
+		if !ok {
+			obj = heldState(observed[name].GetResource().AsMap())
+		}
+		if err := setDesiredResource(resources, name, obj); err != nil {
+			response.Fatal(rsp, err)
+			return nil, nil, err
+		}
+	}
+	for _, name := range withheld {
+		delete(resources, name)
+	}
+
+	return held, withheld, nil
+}
+
+// writableResources returns the desired composed resources of the response,
+// which can be changed without changing the request. The response starts out
+// sharing the request's desired state, so other gates would otherwise see held
+// resources instead of what earlier steps rendered.
+func writableResources(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse) map[string]*fnv1.Resource {
+	if rsp.GetDesired() != req.GetDesired() {
+		if rsp.GetDesired().GetResources() == nil {
+			rsp.Desired.Resources = make(map[string]*fnv1.Resource)
+		}
+		return rsp.GetDesired().GetResources()
+	}
+
+	resources := make(map[string]*fnv1.Resource, len(req.GetDesired().GetResources()))
+	for name, r := range req.GetDesired().GetResources() {
+		resources[name] = r
+	}
+	rsp.Desired = &fnv1.State{Composite: req.GetDesired().GetComposite(), Resources: resources}
+	return resources
+}
+
+// setDesiredResource sets the desired state of a composed resource, keeping
+// its readiness
+func setDesiredResource(resources map[string]*fnv1.Resource, name string, obj map[string]interface{}) error {
+	s, err := structpb.NewStruct(obj)
+	if err != nil {
+		return errors.Wrapf(err, "cannot hold composed resource %s", name)
+	}
+	resources[name] = &fnv1.Resource{Resource: s, Ready: resources[name].GetReady()}
+	return nil
+}
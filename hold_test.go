@@ -0,0 +1,220 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestChangedResources(t *testing.T) {
+	hashes := map[string]string{
+		"db":     "sha256:v1:new",
+		"bucket": "sha256:v1:same",
+		"queue":  "sha256:v1:queue",
+		"cache":  "sha256:v1:cache",
+	}
+	approved := map[string]string{
+		"db":     "sha256:v1:old",
+		"bucket": "sha256:v1:same",
+	}
+	observed := map[string]*fnv1.Resource{
+		"db":     {},
+		"bucket": {},
+		"cache":  {},
+	}
+
+	// The queue doesn't exist yet, and the cache has no approved hash
+	want := []string{"cache", "db"}
+	if got := changedResources(hashes, approved, observed); !reflect.DeepEqual(got, want) {
+		t.Errorf("changedResources(...): want %v, got %v", want, got)
+	}
+}
+
+func TestHeldState(t *testing.T) {
+	observed := map[string]interface{}{
+		"apiVersion": "rds.aws.upbound.io/v1beta1",
+		"kind":       "Instance",
+		"metadata": map[string]interface{}{
+			"name":            "db",
+			"labels":          map[string]interface{}{"tier": "data"},
+			"uid":             "1234",
+			"resourceVersion": "42",
+			"managedFields":   []interface{}{},
+		},
+		"spec":   map[string]interface{}{"forProvider": map[string]interface{}{"instanceClass": "db.t3.micro"}},
+		"status": map[string]interface{}{"atProvider": map[string]interface{}{"id": "db"}},
+	}
+
+	want := map[string]interface{}{
+		"apiVersion": "rds.aws.upbound.io/v1beta1",
+		"kind":       "Instance",
+		"metadata": map[string]interface{}{
+			"name":   "db",
+			"labels": map[string]interface{}{"tier": "data"},
+		},
+		"spec": map[string]interface{}{"forProvider": map[string]interface{}{"instanceClass": "db.t3.micro"}},
+	}
+	if got := heldState(observed); !reflect.DeepEqual(got, want) {
+		t.Errorf("heldState(...): want %v, got %v", want, got)
+	}
+}
+
+func TestApprovedRendering(t *testing.T) {
+	desired := map[string]interface{}{
+		"db":     map[string]interface{}{},
+		"queue":  map[string]interface{}{},
+		"legacy": map[string]interface{}{},
+	}
+	approved := map[string]interface{}{
+		"db":     map[string]interface{}{},
+		"bucket": map[string]interface{}{},
+	}
+	observed := map[string]*fnv1.Resource{
+		"db":     {},
+		"bucket": {},
+		"legacy": {},
+	}
+
+	// The bucket was removed and the queue added since the last approval. The
+	// legacy resource exists, but wasn't rendered at the last approval.
+	held, withheld := approvedRendering(desired, approved, observed)
+	if want := []string{"bucket", "db", "legacy"}; !reflect.DeepEqual(held, want) {
+		t.Errorf("approvedRendering(...): want held %v, got %v", want, held)
+	}
+	if want := []string{"queue"}; !reflect.DeepEqual(withheld, want) {
+		t.Errorf("approvedRendering(...): want withheld %v, got %v", want, withheld)
+	}
+}
+
+func TestTrustedRendering(t *testing.T) {
+	instance := func(class string) map[string]interface{} {
+		return map[string]interface{}{
+			"apiVersion": "rds.aws.upbound.io/v1beta1",
+			"kind":       "Instance",
+			"spec":       map[string]interface{}{"forProvider": map[string]interface{}{"instanceClass": class}},
+		}
+	}
+	role := map[string]interface{}{"apiVersion": "iam.aws.upbound.io/v1beta1", "kind": "Role"}
+
+	approved := map[string]interface{}{
+		"db":      instance("db.t3.micro"),
+		"replica": instance("db.t3.micro"),
+		"cache":   role,
+		"extra":   role,
+	}
+	desired := map[string]interface{}{
+		"replica": instance("db.r5.large"),
+		"cache":   instance("db.r5.large"),
+	}
+	observed := map[string]*fnv1.Resource{
+		"db": {Resource: resource.MustStructJSON(`{
+			"apiVersion": "rds.aws.upbound.io/v1beta1",
+			"kind": "Instance",
+			"spec": {"forProvider": {"instanceClass": "db.t3.micro"}}
+		}`)},
+	}
+
+	// The cache changed kind, and the extra resource is neither desired nor
+	// observed
+	trusted, dropped := trustedRendering(approved, desired, observed)
+	if want := []string{"cache", "extra"}; !reflect.DeepEqual(dropped, want) {
+		t.Errorf("trustedRendering(...): want dropped %v, got %v", want, dropped)
+	}
+	if _, ok := trusted["db"]; !ok {
+		t.Error("trustedRendering(...): expected the observed resource to be trusted")
+	}
+	if _, ok := trusted["replica"]; !ok {
+		t.Error("trustedRendering(...): expected the desired resource to be trusted")
+	}
+}
+
+func TestSealApprovedResources(t *testing.T) {
+	const hash = "sha256:v1:e02c6d35c585a43c62dc2ae14a5385b8a86168b36be7a0d985c0c09afca4ffbe"
+	resources := map[string]interface{}{"db": map[string]interface{}{"kind": "Instance"}}
+
+	encoded, err := encodeApprovedResources(resources, hash, []byte("secret"))
+	if err != nil {
+		t.Fatalf("encodeApprovedResources(...): unexpected error: %v", err)
+	}
+
+	var a approvedResources
+	if err := decodeCompressed(encoded, &a); err != nil {
+		t.Fatalf("decodeCompressed(...): unexpected error: %v", err)
+	}
+	if !verifyApprovedResources(a, []byte("secret")) {
+		t.Error("verifyApprovedResources(...): expected a sealed rendering to be valid")
+	}
+
+	forged := a
+	forged.Resources = map[string]interface{}{"db": map[string]interface{}{"kind": "Role"}}
+	if verifyApprovedResources(forged, []byte("secret")) {
+		t.Error("verifyApprovedResources(...): expected an altered rendering to be invalid")
+	}
+}
+
+func TestSealResourceHashes(t *testing.T) {
+	const (
+		approved = "sha256:v1:e02c6d35c585a43c62dc2ae14a5385b8a86168b36be7a0d985c0c09afca4ffbe"
+		other    = "sha256:v1:a07bdeee84158b7c1b565b1f65ead2f1ff88d0d111b622907e953f19174a1cfb"
+		dbHash   = "sha256:v1:1111111111111111111111111111111111111111111111111111111111111111"
+		iamHash  = "sha256:v1:2222222222222222222222222222222222222222222222222222222222222222"
+	)
+	key := []byte("secret")
+
+	sealed, err := sealResourceHashes(map[string]string{"db": dbHash, "iam": iamHash}, approved, key)
+	if err != nil {
+		t.Fatalf("sealResourceHashes(...): unexpected error: %v", err)
+	}
+	if !sameHash(sealed["db"], dbHash) || !sameHash(sealed["iam"], iamHash) {
+		t.Fatalf("sealResourceHashes(...): expected the sealed hashes to name the same digests, got %v", sealed)
+	}
+
+	cases := map[string]struct {
+		hashes   map[string]string
+		approved string
+		key      []byte
+		want     bool
+	}{
+		"Sealed": {
+			hashes:   sealed,
+			approved: approved,
+			key:      key,
+			want:     true,
+		},
+		"Unsealed": {
+			hashes:   map[string]string{"db": dbHash, "iam": iamHash},
+			approved: approved,
+			key:      key,
+		},
+		"CopiedCurrentHash": {
+			hashes:   map[string]string{"db": sealed["db"], "iam": iamHash},
+			approved: approved,
+			key:      key,
+		},
+		"SwappedNames": {
+			hashes:   map[string]string{"db": sealed["iam"], "iam": sealed["db"]},
+			approved: approved,
+			key:      key,
+		},
+		"OtherApprovedHash": {
+			hashes:   sealed,
+			approved: other,
+			key:      key,
+		},
+		"OtherKey": {
+			hashes:   sealed,
+			approved: approved,
+			key:      []byte("another-secret"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := verifyResourceHashes(tc.hashes, tc.approved, tc.key); got != tc.want {
+				t.Errorf("verifyResourceHashes(...): want %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
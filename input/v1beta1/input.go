@@ -8,6 +8,63 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// Policies for watched fields that are not found.
+const (
+	// MissingFieldPolicyFatal halts the pipeline if a watched field is missing.
+	MissingFieldPolicyFatal = "Fatal"
+
+	// MissingFieldPolicyEmpty treats a missing watched field as empty.
+	MissingFieldPolicyEmpty = "Empty"
+)
+
+// Supported hash algorithms.
+const (
+	// HashAlgorithmSHA256 hashes watched data with SHA-256.
+	HashAlgorithmSHA256 = "sha256"
+
+	// HashAlgorithmSHA512 hashes watched data with SHA-512.
+	HashAlgorithmSHA512 = "sha512"
+
+	// HashAlgorithmXXHash hashes watched data with 64 bit xxHash. It is fast,
+	// but not collision resistant.
+	HashAlgorithmXXHash = "xxhash"
+)
+
+// Classes of change between the approved and the pending data.
+const (
+	// ChangeClassAdditive is a change that adds a value.
+	ChangeClassAdditive = "Additive"
+
+	// ChangeClassModifying is a change that replaces a value.
+	ChangeClassModifying = "Modifying"
+
+	// ChangeClassDestructive is a change that removes a value, or decreases a
+	// number or quantity.
+	ChangeClassDestructive = "Destructive"
+)
+
+// Enforcement modes for changes that aren't approved.
+const (
+	// EnforcementFatal halts the pipeline with a fatal result.
+	EnforcementFatal = "Fatal"
+
+	// EnforcementHold keeps reconciling the desired composed resources as they
+	// were rendered at the last approval.
+	EnforcementHold = "Hold"
+
+	// EnforcementPause pauses the composed resources affected by the change
+	// with the crossplane.io/paused annotation.
+	EnforcementPause = "Pause"
+
+	// EnforcementHoldChanged holds back the composed resources whose desired
+	// state changed since the last approval, and lets the others reconcile.
+	EnforcementHoldChanged = "HoldChanged"
+
+	// EnforcementWarning only reports the change with a warning, and lets it
+	// through.
+	EnforcementWarning = "Warning"
+)
+
 // This isn't a custom resource, in the sense that we never install its CRD.
 // It is a KRM-like object, so we generate a CRD to describe its schema.
 
@@ -19,27 +76,567 @@ type Input struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
+	// GateSpec configures the approval gate used when no Gates are listed
+	GateSpec `json:",inline"`
+
+	// Gates defines several independent approval gates that are evaluated
+	// together. Each gate watches its own fields and is approved separately.
+	// Gates cannot be combined with DataField or DataFields.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Gates []Gate `json:"gates,omitempty"`
+}
+
+// Gate is a named approval gate.
+type Gate struct {
+	// Name identifies the gate. By default the gate keeps its approval state
+	// under "status.gates.<name>", e.g. "status.gates.<name>.approved".
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// ConditionType defines the type of the condition reporting the approval
+	// status of this gate
+	// Default is the camel-cased name followed by "ApprovalRequired", e.g.
+	// "SecurityApprovalRequired" for a gate named "security"
+	// +optional
+	ConditionType *string `json:"conditionType,omitempty"`
+
+	GateSpec `json:",inline"`
+}
+
+// GateSpec configures what an approval gate watches and where it keeps its
+// approval state.
+type GateSpec struct {
 	// DataField defines the object field to hash and store for tracking changes
 	// For example: "spec.resources"
-	DataField string `json:"dataField"`
+	// The path may use wildcards and filters to watch several values, e.g.
+	// "spec.resources.*.size" or "spec.nodePools[?(@.name==\"gpu\")]".
+	// At least one of DataField, DataFields and DesiredResources must be
+	// specified.
+	// +optional
+	DataField string `json:"dataField,omitempty"`
+
+	// DataFields defines several object fields that are hashed together under
+	// a single approval. The combined hash does not depend on their order.
+	// For example: ["spec.parameters", "spec.networking"]
+	// +optional
+	DataFields []string `json:"dataFields,omitempty"`
+
+	// DesiredResources selects desired composed resources rendered by earlier
+	// pipeline steps to watch, in addition to any data fields. Each selected
+	// resource is watched as the field desiredResources.<name>.
+	// +optional
+	DesiredResources *DesiredResources `json:"desiredResources,omitempty"`
+
+	// IgnorePaths defines fields that are stripped from the watched data
+	// before hashing, so changes to them don't require approval. They use the
+	// same path syntax as DataField, and are relative to the XR.
+	// For example: ["spec.resources.*.tags", "spec.resources.description"]
+	// +optional
+	IgnorePaths []string `json:"ignorePaths,omitempty"`
+
+	// Normalization defines how the watched data is canonicalized before
+	// hashing, so that semantically identical data hashes the same.
+	// +optional
+	Normalization *Normalization `json:"normalization,omitempty"`
+
+	// HashAlgorithm defines the algorithm used to hash the watched data.
+	// Hashes are stored as "<algorithm>:<version>:<digest>". Hashes stored by
+	// another algorithm, or as a bare digest by older versions of this
+	// function, are upgraded without approval if the watched data hasn't
+	// changed.
+	// Default is "sha256"
+	// Gates inherit the top-level algorithm if they don't set one.
+	// +optional
+	// +kubebuilder:validation:Enum=sha256;sha512;xxhash
+	HashAlgorithm *string `json:"hashAlgorithm,omitempty"`
+
+	// HashKey defines a secret key used to seal the approved hash with an
+	// HMAC, so that a hash written to the status by anyone but this function
+	// is detected and the change is gated again.
+	// Gates inherit the top-level key if they don't set one.
+	// +optional
+	HashKey *HashKey `json:"hashKey,omitempty"`
+
+	// MissingFieldPolicy defines what happens when a watched field is not
+	// found. Fatal halts the pipeline, Empty treats the field as empty.
+	// Default is "Fatal"
+	// Gates inherit the top-level policy if they don't set one.
+	// +optional
+	// +kubebuilder:validation:Enum=Fatal;Empty
+	MissingFieldPolicy *string `json:"missingFieldPolicy,omitempty"`
 
-	// ApprovalField defines the status field to check for the approval decision
+	// ApprovalField defines the field to check for the approval decision.
+	// The field may be set to true, or to the pending hash (or an unambiguous
+	// prefix of it) to bind the approval to a specific change.
+	// The field is usually in status, but may also be an annotation, such as
+	// `metadata.annotations["approve.fn.crossplane.io/approved"]`, or a spec
+	// field. Annotations and spec fields may hold "true" and "false" as
+	// strings. They can't be reset by the function, so an approval of true
+	// is only used once, until it's removed or set to false.
 	// Default is "status.approved"
 	// +optional
 	ApprovalField *string `json:"approvalField,omitempty"`
 
+	// ConsumedApprovalField defines where to record the hash an approval of
+	// true was used for, when the approval field is an annotation or a spec
+	// field.
+	// Default is "status.consumedApproval"
+	// +optional
+	ConsumedApprovalField *string `json:"consumedApprovalField,omitempty"`
+
 	// CurrentHashField defines where to store the current approved hash value
 	// Default is "status.currentHash"
 	// +optional
 	CurrentHashField *string `json:"currentHashField,omitempty"`
 
+	// PendingHashField defines where to publish the hash that is waiting for
+	// approval. An approval is only accepted if it names this hash.
+	// Default is "status.pendingHash"
+	// +optional
+	PendingHashField *string `json:"pendingHashField,omitempty"`
+
+	// FieldHashesField defines where to store the per-field hashes of the
+	// approved data when more than one field is watched, or when a path can
+	// match several fields. They are used to report which fields changed.
+	// Default is "status.fieldHashes"
+	// +optional
+	FieldHashesField *string `json:"fieldHashesField,omitempty"`
+
+	// IgnoredHashesField defines where to store the per-field hashes of the
+	// ignored fields at the last approval. They are used to report which
+	// ignored fields changed without requiring approval.
+	// Default is "status.ignoredHashes"
+	// +optional
+	IgnoredHashesField *string `json:"ignoredHashesField,omitempty"`
+
+	// HashSettingsField defines where to record the ignore paths and
+	// normalization the approved hash was computed with. They are used to
+	// reproduce the approved hash after these settings change.
+	// Default is "status.hashSettings"
+	// +optional
+	HashSettingsField *string `json:"hashSettingsField,omitempty"`
+
+	// SnapshotField defines where to store a snapshot of the watched data at
+	// the last approval. The snapshot is stored as base64 encoded, gzipped
+	// JSON, and is used to show what changed since the last approval.
+	// Default is "status.approvedSnapshot"
+	// +optional
+	SnapshotField *string `json:"snapshotField,omitempty"`
+
+	// ResourceHashesField defines where to store a hash of the desired state
+	// of each composed resource at the last approval. They are used to find
+	// the resources to hold back when Enforcement is HoldChanged.
+	// Default is "status.resourceHashes"
+	// +optional
+	ResourceHashesField *string `json:"resourceHashesField,omitempty"`
+
+	// ApprovedResourcesField defines where to store the desired composed
+	// resources as they were rendered at the last approval, when Enforcement
+	// is Hold or HoldChanged. They are stored as base64 encoded, gzipped JSON.
+	// Default is "status.approvedResources"
+	// +optional
+	ApprovedResourcesField *string `json:"approvedResourcesField,omitempty"`
+
+	// PausedResourcesField defines where to record the composed resources
+	// that were paused while a change waited for approval, when Enforcement
+	// is Pause. They are unpaused once the change is approved.
+	// Default is "status.pausedResources"
+	// +optional
+	PausedResourcesField *string `json:"pausedResourcesField,omitempty"`
+
+	// AuditField defines where to record the change that would have required
+	// approval, when Enforcement is Warning. The record holds the "hash" of
+	// the change, the "reason" approval would be required, the "source" the
+	// approval is read from, and a "count" of the changes that would have
+	// required approval.
+	// Default is "status.audit"
+	// +optional
+	AuditField *string `json:"auditField,omitempty"`
+
+	// MaxApprovedResourcesSize defines the largest rendering of approved
+	// resources to store, in bytes after encoding. A larger rendering isn't
+	// stored, and held resources keep their observed state instead.
+	// Default is 262144
+	// Gates inherit the top-level size if they don't set one.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxApprovedResourcesSize *int `json:"maxApprovedResourcesSize,omitempty"`
+
+	// MaxSnapshotSize defines the largest snapshot to store, in bytes after
+	// encoding. A larger snapshot isn't stored. Set it to 0 to disable
+	// snapshots.
+	// Default is 32768
+	// Gates inherit the top-level size if they don't set one.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxSnapshotSize *int `json:"maxSnapshotSize,omitempty"`
+
+	// PatchField defines where to publish the pending change as structured
+	// data when approval is required. The change is published as an object
+	// with the pending "hash", an RFC 6902 JSON Patch ("jsonPatch") and an
+	// RFC 7386 JSON Merge Patch ("mergePatch") that turn the approved data
+	// into the pending data. Patches are relative to the XR, and are only
+	// included if a snapshot of the approved data is available. There is no
+	// merge patch if a watched path selects a list element.
+	// The change isn't published unless this is set.
+	// +optional
+	PatchField *string `json:"patchField,omitempty"`
+
+	// RequireApprovalFor defines which classes of change require approval.
+	// Additions are Additive, removals and decreases of numbers or quantities
+	// such as "100Gi" are Destructive, and any other change is Modifying.
+	// Changes can only be classified if a snapshot of the approved data is
+	// available. Otherwise every change requires approval.
+	// Default is all classes
+	// Gates inherit the top-level classes if they don't set any.
+	// +optional
+	// +kubebuilder:validation:items:Enum=Additive;Modifying;Destructive
+	RequireApprovalFor []string `json:"requireApprovalFor,omitempty"`
+
+	// Tolerances let small changes to numbers and quantities through without
+	// approval. Changes within a tolerance don't count towards the classes in
+	// RequireApprovalFor. Tolerances are only applied if a snapshot of the
+	// approved data is available.
+	// Gates inherit the top-level tolerances if they don't set any.
+	// +optional
+	Tolerances []Tolerance `json:"tolerances,omitempty"`
+
+	// AutoApprove defines CEL rules that approve a change without an
+	// approval. A change is approved if any rule evaluates to true. Rules are
+	// only evaluated if a snapshot of the approved data is available.
+	// Gates inherit the top-level rules if they don't set any.
+	// +optional
+	AutoApprove []AutoApproveRule `json:"autoApprove,omitempty"`
+
+	// Quorum requires approvals from several distinct approvers. The approval
+	// field must then hold a list of approver records, each with the
+	// approver's "name" and "group", the "hash" they approve and a
+	// "timestamp". A boolean approval or a hash on its own doesn't satisfy a
+	// quorum.
+	// Gates inherit the top-level quorum if they don't set one.
+	// +optional
+	Quorum *Quorum `json:"quorum,omitempty"`
+
+	// ApproverDirectory lists who may approve changes, and the groups they
+	// are members of. Approver records are rejected if their approver isn't
+	// listed, or names a group the approver isn't a member of. A boolean
+	// approval or a hash on its own doesn't identify an approver, so only
+	// approver records are accepted.
+	// Gates inherit the top-level directory if they don't set one.
+	// +optional
+	ApproverDirectory *ApproverDirectory `json:"approverDirectory,omitempty"`
+
+	// ApprovalSignatures requires every approver record to be signed with a
+	// trusted key. A record must carry the "keyId" of the key, an "expires"
+	// RFC 3339 timestamp and a base64 encoded "signature" over the XR's UID,
+	// the pending hash, the expiry, the approver's name and group, separated
+	// by newlines. Records that aren't signed, whose signature is invalid or
+	// expired, or whose key isn't bound to the approver and group they name,
+	// are rejected. Only approver records are accepted.
+	// Gates inherit the top-level keys if they don't set any.
+	// +optional
+	ApprovalSignatures *ApprovalSignatures `json:"approvalSignatures,omitempty"`
+
+	// ApprovalObjects reads approvals from separate objects instead of the
+	// approval field, so that who can approve a change is decided by who can
+	// create the objects rather than who can update the XR. Each object is
+	// an approver record for the XR it is labelled with.
+	// Gates inherit the top-level objects if they don't set any.
+	// +optional
+	ApprovalObjects *ApprovalObjects `json:"approvalObjects,omitempty"`
+
+	// Enforcement defines what happens to a change that isn't approved:
+	//   - Fatal halts the pipeline with a fatal result.
+	//   - Hold replaces the desired composed resources with the ones rendered
+	//     at the last approval, so they keep reconciling as approved.
+	//   - HoldChanged holds back the composed resources whose desired state
+	//     changed since the last approval. They keep their approved state,
+	//     while new and unchanged resources keep reconciling.
+	//   - Pause passes the change on, but pauses the new composed resources
+	//     and the ones whose desired state changed with the
+	//     crossplane.io/paused annotation, so providers don't act on them.
+	//   - Warning lets the change through, and only reports that it would
+	//     require approval with a warning and an ApprovalWouldBeRequired
+	//     condition. The approved hash only changes when a change is approved.
+	//
+	// Default is Fatal
+	// Gates inherit the top-level mode if they don't set one.
+	// +optional
+	// +kubebuilder:validation:Enum=Fatal;Hold;HoldChanged;Pause;Warning
+	Enforcement *string `json:"enforcement,omitempty"`
+
+	// EnforcementOverrides defines the enforcement modes an XR may select
+	// with the approve.fn.crossplane.io/enforcement annotation, or the
+	// <gate>.approve.fn.crossplane.io/enforcement annotation for a single
+	// gate. Other modes selected by an annotation are ignored with a warning.
+	// Default is none, so annotations are ignored
+	// Gates inherit the top-level modes if they don't set any.
+	// +optional
+	// +kubebuilder:validation:items:Enum=Fatal;Hold;HoldChanged;Pause;Warning
+	EnforcementOverrides []string `json:"enforcementOverrides,omitempty"`
+
 	// DetailedCondition adds a detailed condition about approval status
 	// Default is true
+	// Gates inherit the top-level setting if they don't set one.
 	// +optional
 	DetailedCondition *bool `json:"detailedCondition,omitempty"`
 
 	// ApprovalMessage sets a message to display when approval is required
 	// Default is "Changes detected. Approval required."
+	// Gates inherit the top-level message if they don't set one.
 	// +optional
 	ApprovalMessage *string `json:"approvalMessage,omitempty"`
 }
+
+// DesiredResources selects desired composed resources by their name in the
+// pipeline, their type and their labels. A resource must match every filter
+// that is set. If no filter is set every desired composed resource is
+// selected.
+type DesiredResources struct {
+	// Names are the names of the resources in the pipeline.
+	// +optional
+	Names []string `json:"names,omitempty"`
+
+	// APIVersion is the apiVersion of the resources, e.g.
+	// "rds.aws.upbound.io/v1beta1".
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind is the kind of the resources, e.g. "Instance".
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Selector selects resources by their labels.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// IgnorePaths defines fields stripped from each selected resource before
+	// hashing. They use the same path syntax as DataField, and are relative
+	// to the resource.
+	// For example: ["metadata.annotations", "spec.forProvider.tags"]
+	// +optional
+	IgnorePaths []string `json:"ignorePaths,omitempty"`
+}
+
+// Normalization configures how watched data is canonicalized before hashing.
+// Enabling an option changes the hash of data it affects. Approved hashes are
+// upgraded without approval if the data hasn't changed since.
+type Normalization struct {
+	// SetPaths defines lists that are treated as sets. Their elements are
+	// sorted and duplicates removed, so reordering them doesn't change the
+	// hash. They use the same path syntax as DataField, and are relative to
+	// the XR.
+	// For example: ["spec.resources.subnets", "spec.resources.*.zones"]
+	// +optional
+	SetPaths []string `json:"setPaths,omitempty"`
+
+	// DropEmpty removes nulls, empty maps and empty lists from maps, so an
+	// empty field hashes the same as an absent one.
+	// +optional
+	DropEmpty bool `json:"dropEmpty,omitempty"`
+
+	// NormalizeNumbers writes every number in a single canonical form, so that e.g. 1
+	// and 1.0 hash the same.
+	// +optional
+	NormalizeNumbers bool `json:"normalizeNumbers,omitempty"`
+
+	// TrimStrings trims leading and trailing whitespace from strings and converts
+	// Windows line endings to Unix ones.
+	// +optional
+	TrimStrings bool `json:"trimStrings,omitempty"`
+}
+
+// Tolerance defines how much a number or a quantity, such as "100Gi" or
+// "500m", may change without approval.
+type Tolerance struct {
+	// Path selects the values the tolerance applies to. It uses the same path
+	// syntax as DataField, and is relative to the XR.
+	// For example: "spec.resources.nodePools[*].count"
+	Path string `json:"path"`
+
+	// MaxIncrease is the largest increase that doesn't require approval. It is
+	// either an absolute amount, such as "2" or "10Gi", or a percentage of the
+	// approved value, such as "20%".
+	// Increases require approval unless this is set.
+	// +optional
+	MaxIncrease *string `json:"maxIncrease,omitempty"`
+
+	// MaxDecrease is the largest decrease that doesn't require approval, in
+	// the same form as MaxIncrease.
+	// Decreases require approval unless this is set.
+	// +optional
+	MaxDecrease *string `json:"maxDecrease,omitempty"`
+}
+
+// AutoApproveRule is a CEL expression that approves a change when it evaluates
+// to true. It can use these variables:
+//   - old: the approved data
+//   - new: the pending data
+//   - observed: the observed XR
+//   - diff: the changes, as lists of {path, class, old, new} under "added",
+//     "removed" and "changed". A list is absent if there are no such changes.
+//
+// The data is the value of the watched field if a single field without
+// wildcards is watched, and otherwise a map of values keyed by path. Whole
+// numbers are integers.
+type AutoApproveRule struct {
+	// Name identifies the rule in conditions and results. Default is the
+	// rule's expression.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Expression is the CEL expression to evaluate.
+	// For example: "new.replicas <= old.replicas * 2" or "!has(diff.removed)"
+	Expression string `json:"expression"`
+}
+
+// Quorum defines how many distinct approvers must approve a change.
+type Quorum struct {
+	// Approvals is the number of distinct approvers required.
+	// +kubebuilder:validation:Minimum=1
+	Approvals int `json:"approvals"`
+
+	// Groups require some of the approvers to be members of a group. An
+	// approver counts towards the total and towards their group.
+	// +optional
+	Groups []GroupQuorum `json:"groups,omitempty"`
+}
+
+// GroupQuorum defines how many approvers must be members of a group.
+type GroupQuorum struct {
+	// Name is the name of the group.
+	Name string `json:"name"`
+
+	// Approvals is the number of distinct approvers required from the group.
+	// +kubebuilder:validation:Minimum=1
+	Approvals int `json:"approvals"`
+}
+
+// Approver directory kinds.
+const (
+	// ApproverDirectoryConfigMap reads the directory from a ConfigMap.
+	ApproverDirectoryConfigMap = "ConfigMap"
+
+	// ApproverDirectoryEnvironmentConfig reads the directory from a Crossplane
+	// EnvironmentConfig.
+	ApproverDirectoryEnvironmentConfig = "EnvironmentConfig"
+)
+
+// ApproverDirectory configures the object the approver directory is read
+// from. The object is fetched as a required resource. Each key of its data
+// is an approver's name, and its value lists the approver's groups, either as
+// a list or as a comma separated string.
+type ApproverDirectory struct {
+	// Kind of the object, ConfigMap or EnvironmentConfig.
+	// Default is ConfigMap
+	// +optional
+	// +kubebuilder:validation:Enum=ConfigMap;EnvironmentConfig
+	Kind string `json:"kind,omitempty"`
+
+	// APIVersion of the object.
+	// Default is "v1" for a ConfigMap and
+	// "apiextensions.crossplane.io/v1beta1" for an EnvironmentConfig
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Name of the object.
+	Name string `json:"name"`
+
+	// Namespace of the object. Required for a ConfigMap.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ApprovalObjects configures the objects approvals are read from. The objects
+// are fetched as required resources, selected by the
+// approve.fn.crossplane.io/xr-uid label holding the XR's UID, and for a named
+// gate the approve.fn.crossplane.io/gate label holding the gate's name.
+type ApprovalObjects struct {
+	// APIVersion of the objects.
+	// Default is "v1"
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind of the objects.
+	// Default is "ConfigMap"
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Namespace of the objects. Required for a ConfigMap, so that approvals
+	// can only be created where approvers have access.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// MatchLabels are further labels the objects must have.
+	// +optional
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+
+	// Field of each object holding the approver record, with the approver's
+	// "name", "group", the "hash" they approve, and any of "timestamp",
+	// "keyId", "expires" and "signature". The name defaults to the object's
+	// name.
+	// Default is "data" for a ConfigMap and "spec" otherwise
+	// +optional
+	Field string `json:"field,omitempty"`
+}
+
+// ApprovalSignatures configures where the public keys trusted to sign
+// approvals are read from. Exactly one of CredentialsName and Directory must
+// be set. Keys are PEM encoded ed25519 or ECDSA public keys, identified by
+// their key in the credentials data or their file name. Each key must be
+// bound to the approver who signs with it.
+type ApprovalSignatures struct {
+	// CredentialsName is the name of the function credentials that hold the
+	// keys, as listed in the pipeline step's credentials.
+	// +optional
+	CredentialsName string `json:"credentialsName,omitempty"`
+
+	// Directory is the path of a directory mounted into the function pod
+	// that holds a file per key.
+	// +optional
+	Directory string `json:"directory,omitempty"`
+
+	// Signers binds each trusted key to the approver who signs with it, and
+	// the groups it may sign for. A record signed with a key that isn't
+	// bound to its approver, or that names a group the key may not sign for,
+	// is rejected.
+	// +kubebuilder:validation:MinItems=1
+	Signers []ApprovalSigner `json:"signers"`
+}
+
+// ApprovalSigner binds a trusted key to an approver.
+type ApprovalSigner struct {
+	// KeyID is the ID of the key.
+	KeyID string `json:"keyId"`
+
+	// Name of the approver who signs with the key.
+	Name string `json:"name"`
+
+	// Groups the key may sign for. A record without a group can be signed
+	// by any key of its approver.
+	// +optional
+	Groups []string `json:"groups,omitempty"`
+}
+
+// HashKey configures where the key used to seal approved hashes is read from.
+// Exactly one of CredentialsName and File must be set. Leading and trailing
+// whitespace of the key is ignored.
+type HashKey struct {
+	// CredentialsName is the name of the function credentials that hold the
+	// key, as listed in the pipeline step's credentials.
+	// +optional
+	CredentialsName string `json:"credentialsName,omitempty"`
+
+	// CredentialsKey is the key within the credentials data that holds the key.
+	// Default is "key"
+	// +optional
+	CredentialsKey *string `json:"credentialsKey,omitempty"`
+
+	// File is the path of a file mounted into the function pod that holds the
+	// key.
+	// +optional
+	File string `json:"file,omitempty"`
+}
@@ -5,24 +5,315 @@
 package v1beta1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Input) DeepCopyInto(out *Input) {
+func (in *ApprovalObjects) DeepCopyInto(out *ApprovalObjects) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.MatchLabels != nil {
+		in, out := &in.MatchLabels, &out.MatchLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApprovalObjects.
+func (in *ApprovalObjects) DeepCopy() *ApprovalObjects {
+	if in == nil {
+		return nil
+	}
+	out := new(ApprovalObjects)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApprovalSigner) DeepCopyInto(out *ApprovalSigner) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApprovalSigner.
+func (in *ApprovalSigner) DeepCopy() *ApprovalSigner {
+	if in == nil {
+		return nil
+	}
+	out := new(ApprovalSigner)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApprovalSignatures) DeepCopyInto(out *ApprovalSignatures) {
+	*out = *in
+	if in.Signers != nil {
+		in, out := &in.Signers, &out.Signers
+		*out = make([]ApprovalSigner, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApprovalSignatures.
+func (in *ApprovalSignatures) DeepCopy() *ApprovalSignatures {
+	if in == nil {
+		return nil
+	}
+	out := new(ApprovalSignatures)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApproverDirectory) DeepCopyInto(out *ApproverDirectory) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApproverDirectory.
+func (in *ApproverDirectory) DeepCopy() *ApproverDirectory {
+	if in == nil {
+		return nil
+	}
+	out := new(ApproverDirectory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoApproveRule) DeepCopyInto(out *AutoApproveRule) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoApproveRule.
+func (in *AutoApproveRule) DeepCopy() *AutoApproveRule {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoApproveRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DesiredResources) DeepCopyInto(out *DesiredResources) {
+	*out = *in
+	if in.Names != nil {
+		in, out := &in.Names, &out.Names
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IgnorePaths != nil {
+		in, out := &in.IgnorePaths, &out.IgnorePaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DesiredResources.
+func (in *DesiredResources) DeepCopy() *DesiredResources {
+	if in == nil {
+		return nil
+	}
+	out := new(DesiredResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Gate) DeepCopyInto(out *Gate) {
+	*out = *in
+	if in.ConditionType != nil {
+		in, out := &in.ConditionType, &out.ConditionType
+		*out = new(string)
+		**out = **in
+	}
+	in.GateSpec.DeepCopyInto(&out.GateSpec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Gate.
+func (in *Gate) DeepCopy() *Gate {
+	if in == nil {
+		return nil
+	}
+	out := new(Gate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GateSpec) DeepCopyInto(out *GateSpec) {
+	*out = *in
+	if in.DataFields != nil {
+		in, out := &in.DataFields, &out.DataFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DesiredResources != nil {
+		in, out := &in.DesiredResources, &out.DesiredResources
+		*out = new(DesiredResources)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IgnorePaths != nil {
+		in, out := &in.IgnorePaths, &out.IgnorePaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Normalization != nil {
+		in, out := &in.Normalization, &out.Normalization
+		*out = new(Normalization)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HashAlgorithm != nil {
+		in, out := &in.HashAlgorithm, &out.HashAlgorithm
+		*out = new(string)
+		**out = **in
+	}
+	if in.HashKey != nil {
+		in, out := &in.HashKey, &out.HashKey
+		*out = new(HashKey)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MissingFieldPolicy != nil {
+		in, out := &in.MissingFieldPolicy, &out.MissingFieldPolicy
+		*out = new(string)
+		**out = **in
+	}
 	if in.ApprovalField != nil {
 		in, out := &in.ApprovalField, &out.ApprovalField
 		*out = new(string)
 		**out = **in
 	}
+	if in.ConsumedApprovalField != nil {
+		in, out := &in.ConsumedApprovalField, &out.ConsumedApprovalField
+		*out = new(string)
+		**out = **in
+	}
 	if in.CurrentHashField != nil {
 		in, out := &in.CurrentHashField, &out.CurrentHashField
 		*out = new(string)
 		**out = **in
 	}
+	if in.PendingHashField != nil {
+		in, out := &in.PendingHashField, &out.PendingHashField
+		*out = new(string)
+		**out = **in
+	}
+	if in.FieldHashesField != nil {
+		in, out := &in.FieldHashesField, &out.FieldHashesField
+		*out = new(string)
+		**out = **in
+	}
+	if in.IgnoredHashesField != nil {
+		in, out := &in.IgnoredHashesField, &out.IgnoredHashesField
+		*out = new(string)
+		**out = **in
+	}
+	if in.HashSettingsField != nil {
+		in, out := &in.HashSettingsField, &out.HashSettingsField
+		*out = new(string)
+		**out = **in
+	}
+	if in.SnapshotField != nil {
+		in, out := &in.SnapshotField, &out.SnapshotField
+		*out = new(string)
+		**out = **in
+	}
+	if in.ResourceHashesField != nil {
+		in, out := &in.ResourceHashesField, &out.ResourceHashesField
+		*out = new(string)
+		**out = **in
+	}
+	if in.ApprovedResourcesField != nil {
+		in, out := &in.ApprovedResourcesField, &out.ApprovedResourcesField
+		*out = new(string)
+		**out = **in
+	}
+	if in.PausedResourcesField != nil {
+		in, out := &in.PausedResourcesField, &out.PausedResourcesField
+		*out = new(string)
+		**out = **in
+	}
+	if in.AuditField != nil {
+		in, out := &in.AuditField, &out.AuditField
+		*out = new(string)
+		**out = **in
+	}
+	if in.MaxApprovedResourcesSize != nil {
+		in, out := &in.MaxApprovedResourcesSize, &out.MaxApprovedResourcesSize
+		*out = new(int)
+		**out = **in
+	}
+	if in.MaxSnapshotSize != nil {
+		in, out := &in.MaxSnapshotSize, &out.MaxSnapshotSize
+		*out = new(int)
+		**out = **in
+	}
+	if in.PatchField != nil {
+		in, out := &in.PatchField, &out.PatchField
+		*out = new(string)
+		**out = **in
+	}
+	if in.RequireApprovalFor != nil {
+		in, out := &in.RequireApprovalFor, &out.RequireApprovalFor
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Tolerances != nil {
+		in, out := &in.Tolerances, &out.Tolerances
+		*out = make([]Tolerance, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AutoApprove != nil {
+		in, out := &in.AutoApprove, &out.AutoApprove
+		*out = make([]AutoApproveRule, len(*in))
+		copy(*out, *in)
+	}
+	if in.Quorum != nil {
+		in, out := &in.Quorum, &out.Quorum
+		*out = new(Quorum)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ApproverDirectory != nil {
+		in, out := &in.ApproverDirectory, &out.ApproverDirectory
+		*out = new(ApproverDirectory)
+		**out = **in
+	}
+	if in.ApprovalSignatures != nil {
+		in, out := &in.ApprovalSignatures, &out.ApprovalSignatures
+		*out = new(ApprovalSignatures)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ApprovalObjects != nil {
+		in, out := &in.ApprovalObjects, &out.ApprovalObjects
+		*out = new(ApprovalObjects)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Enforcement != nil {
+		in, out := &in.Enforcement, &out.Enforcement
+		*out = new(string)
+		**out = **in
+	}
+	if in.EnforcementOverrides != nil {
+		in, out := &in.EnforcementOverrides, &out.EnforcementOverrides
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.DetailedCondition != nil {
 		in, out := &in.DetailedCondition, &out.DetailedCondition
 		*out = new(bool)
@@ -35,6 +326,66 @@ func (in *Input) DeepCopyInto(out *Input) {
 	}
 }
 
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GateSpec.
+func (in *GateSpec) DeepCopy() *GateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupQuorum) DeepCopyInto(out *GroupQuorum) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupQuorum.
+func (in *GroupQuorum) DeepCopy() *GroupQuorum {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupQuorum)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HashKey) DeepCopyInto(out *HashKey) {
+	*out = *in
+	if in.CredentialsKey != nil {
+		in, out := &in.CredentialsKey, &out.CredentialsKey
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashKey.
+func (in *HashKey) DeepCopy() *HashKey {
+	if in == nil {
+		return nil
+	}
+	out := new(HashKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Input) DeepCopyInto(out *Input) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.GateSpec.DeepCopyInto(&out.GateSpec)
+	if in.Gates != nil {
+		in, out := &in.Gates, &out.Gates
+		*out = make([]Gate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Input.
 func (in *Input) DeepCopy() *Input {
 	if in == nil {
@@ -52,3 +403,68 @@ func (in *Input) DeepCopyObject() runtime.Object {
 	}
 	return nil
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Normalization) DeepCopyInto(out *Normalization) {
+	*out = *in
+	if in.SetPaths != nil {
+		in, out := &in.SetPaths, &out.SetPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Normalization.
+func (in *Normalization) DeepCopy() *Normalization {
+	if in == nil {
+		return nil
+	}
+	out := new(Normalization)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Quorum) DeepCopyInto(out *Quorum) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]GroupQuorum, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Quorum.
+func (in *Quorum) DeepCopy() *Quorum {
+	if in == nil {
+		return nil
+	}
+	out := new(Quorum)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Tolerance) DeepCopyInto(out *Tolerance) {
+	*out = *in
+	if in.MaxIncrease != nil {
+		in, out := &in.MaxIncrease, &out.MaxIncrease
+		*out = new(string)
+		**out = **in
+	}
+	if in.MaxDecrease != nil {
+		in, out := &in.MaxDecrease, &out.MaxDecrease
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Tolerance.
+func (in *Tolerance) DeepCopy() *Tolerance {
+	if in == nil {
+		return nil
+	}
+	out := new(Tolerance)
+	in.DeepCopyInto(out)
+	return out
+}
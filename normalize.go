@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// normalizeSets sorts and deduplicates every list matched by the set paths in
+// the supplied data. Values that aren't lists are left alone.
+func normalizeSets(data map[string]interface{}, n *v1beta1.Normalization) error {
+	if n == nil {
+		return nil
+	}
+
+	for _, path := range n.SetPaths {
+		matches, err := ExpandPath(data, path)
+		if err != nil {
+			return errors.Wrapf(err, "invalid set path %s", path)
+		}
+
+		for _, m := range matches {
+			list, ok := m.Value.([]interface{})
+			if !ok {
+				continue
+			}
+			if err := SetNestedValue(data, m.Path, normalizeSet(list, n)); err != nil {
+				return errors.Wrapf(err, "cannot normalize set %s", m.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeSet returns the normalized elements of a list sorted by their JSON
+// encoding, with duplicates removed
+func normalizeSet(list []interface{}, n *v1beta1.Normalization) []interface{} {
+	type element struct {
+		key   string
+		value interface{}
+	}
+
+	elements := make([]element, 0, len(list))
+	for _, v := range list {
+		v = normalizeValue(v, n)
+		key, err := json.Marshal(v)
+		if err != nil {
+			// Keep values we can't order where they are, rather than losing them
+			key = nil
+		}
+		elements = append(elements, element{key: string(key), value: v})
+	}
+
+	sort.SliceStable(elements, func(i, j int) bool { return elements[i].key < elements[j].key })
+
+	set := make([]interface{}, 0, len(elements))
+	for i, e := range elements {
+		if i > 0 && e.key != "" && e.key == elements[i-1].key {
+			continue
+		}
+		set = append(set, e.value)
+	}
+	return set
+}
+
+// normalizeValue returns a normalized copy of a watched value. A value that
+// is dropped entirely because it's empty is returned as nil.
+func normalizeValue(value interface{}, n *v1beta1.Normalization) interface{} {
+	if n == nil {
+		return value
+	}
+
+	v, _ := normalize(value, n)
+	return v
+}
+
+// normalize returns a normalized copy of the value, and whether it should be
+// kept when it's found in a map
+func normalize(value interface{}, n *v1beta1.Normalization) (interface{}, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, !n.DropEmpty
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			if c, keep := normalize(child, n); keep {
+				out[k] = c
+			}
+		}
+		return out, !n.DropEmpty || len(out) > 0
+	case []interface{}:
+		// List elements are positional, so they are never dropped
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			out[i], _ = normalize(child, n)
+		}
+		return out, !n.DropEmpty || len(out) > 0
+	case string:
+		if n.TrimStrings {
+			return strings.TrimSpace(strings.ReplaceAll(v, "\r\n", "\n")), true
+		}
+		return v, true
+	case float64:
+		if n.NormalizeNumbers {
+			return normalizeNumber(v), true
+		}
+		return v, true
+	case json.Number:
+		if !n.NormalizeNumbers {
+			return v, true
+		}
+		if f, err := v.Float64(); err == nil {
+			return normalizeNumber(f), true
+		}
+		return v, true
+	default:
+		return v, true
+	}
+}
+
+// normalizeNumber returns whole numbers as integers, so they are encoded
+// without a fraction or exponent, and any other number as a float
+func normalizeNumber(f float64) interface{} {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return f
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	cases := map[string]struct {
+		n     *v1beta1.Normalization
+		value interface{}
+		want  interface{}
+	}{
+		"NoNormalization": {
+			value: map[string]interface{}{"tags": map[string]interface{}{}, "name": " db "},
+			want:  map[string]interface{}{"tags": map[string]interface{}{}, "name": " db "},
+		},
+		"DropEmpty": {
+			n: &v1beta1.Normalization{DropEmpty: true},
+			value: map[string]interface{}{
+				"tags":   map[string]interface{}{},
+				"labels": map[string]interface{}{"team": nil},
+				"zones":  []interface{}{},
+				"users":  []interface{}{nil, "alice"},
+				"name":   "",
+			},
+			want: map[string]interface{}{
+				"users": []interface{}{nil, "alice"},
+				"name":  "",
+			},
+		},
+		"DropEmptyRoot": {
+			n:     &v1beta1.Normalization{DropEmpty: true},
+			value: map[string]interface{}{"tags": map[string]interface{}{}},
+			want:  map[string]interface{}{},
+		},
+		"NormalizeNumbers": {
+			n:     &v1beta1.Normalization{NormalizeNumbers: true},
+			value: []interface{}{float64(1), 1.5, float64(-0)},
+			want:  []interface{}{int64(1), 1.5, int64(0)},
+		},
+		"TrimStrings": {
+			n:     &v1beta1.Normalization{TrimStrings: true},
+			value: map[string]interface{}{"script": "  echo a\r\necho b\n"},
+			want:  map[string]interface{}{"script": "echo a\necho b"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := normalizeValue(tc.value, tc.n)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("normalizeValue(...): want %#v, got %#v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNormalizeSets(t *testing.T) {
+	data := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"subnets": []interface{}{"b", " a", "c", "a"},
+			"resources": map[string]interface{}{
+				"db":    map[string]interface{}{"zones": []interface{}{"z2", "z1"}},
+				"cache": map[string]interface{}{"zones": "z1"},
+			},
+			"users": []interface{}{"bob", "alice"},
+		},
+	}
+
+	n := &v1beta1.Normalization{
+		SetPaths:    []string{"spec.subnets", "spec.resources.*.zones", "spec.missing"},
+		TrimStrings: true,
+	}
+	if err := normalizeSets(data, n); err != nil {
+		t.Fatalf("normalizeSets(...): unexpected error: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"subnets": []interface{}{"a", "b", "c"},
+			"resources": map[string]interface{}{
+				"db":    map[string]interface{}{"zones": []interface{}{"z1", "z2"}},
+				"cache": map[string]interface{}{"zones": "z1"},
+			},
+			"users": []interface{}{"bob", "alice"},
+		},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("normalizeSets(...): want %v, got %v", want, data)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+const (
+	// xrUIDLabel labels an approval object with the UID of the XR it approves
+	xrUIDLabel = "approve.fn.crossplane.io/xr-uid"
+
+	// gateLabel labels an approval object with the name of the gate it
+	// approves
+	gateLabel = "approve.fn.crossplane.io/gate"
+)
+
+// approvalObjectsKey returns the key the gate's approval objects are required
+// under
+func approvalObjectsKey(g *v1beta1.Gate) string {
+	if g.Name != "" {
+		return "approval-objects-" + g.Name
+	}
+	return "approval-objects"
+}
+
+// approvalObjectsKind returns the API version and kind of approval objects
+func approvalObjectsKind(o *v1beta1.ApprovalObjects) (string, string) {
+	apiVersion, kind := o.APIVersion, o.Kind
+	if apiVersion == "" {
+		apiVersion = "v1"
+	}
+	if kind == "" {
+		kind = "ConfigMap"
+	}
+	return apiVersion, kind
+}
+
+// approvalObjectsSelector returns the selector of the objects approving
+// changes of the XR with the supplied UID
+func approvalObjectsSelector(o *v1beta1.ApprovalObjects, g *v1beta1.Gate, uid string) *fnv1.ResourceSelector {
+	labels := make(map[string]string, len(o.MatchLabels)+2)
+	for k, v := range o.MatchLabels {
+		labels[k] = v
+	}
+	labels[xrUIDLabel] = uid
+	if g.Name != "" {
+		labels[gateLabel] = g.Name
+	}
+
+	apiVersion, kind := approvalObjectsKind(o)
+	sel := &fnv1.ResourceSelector{
+		ApiVersion: apiVersion,
+		Kind:       kind,
+		Match:      &fnv1.ResourceSelector_MatchLabels{MatchLabels: &fnv1.MatchLabels{Labels: labels}},
+	}
+	if o.Namespace != "" {
+		sel.Namespace = &o.Namespace
+	}
+	return sel
+}
+
+// approvalObjectsField returns the field of each approval object that holds
+// its approver record
+func approvalObjectsField(o *v1beta1.ApprovalObjects) string {
+	if o.Field != "" {
+		return o.Field
+	}
+	if _, kind := approvalObjectsKind(o); kind == "ConfigMap" {
+		return "data"
+	}
+	return "spec"
+}
+
+// approvalRecords returns the approver records held by the approval objects,
+// sorted by object name. An approver defaults to the object's name. Objects
+// without a hash don't approve anything, so they're skipped rather than
+// failing the XR.
+func approvalRecords(objs []*unstructured.Unstructured, field string) []interface{} {
+	sorted := make([]*unstructured.Unstructured, len(objs))
+	copy(sorted, objs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].GetName() < sorted[j].GetName() })
+
+	records := make([]interface{}, 0, len(sorted))
+	for _, obj := range sorted {
+		value, _, err := GetNestedValue(obj.Object, field)
+		if err != nil {
+			continue
+		}
+		data, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if hash, _ := data["hash"].(string); hash == "" {
+			continue
+		}
+
+		record := make(map[string]interface{}, len(data)+1)
+		for k, v := range data {
+			record[k] = v
+		}
+		if name, _ := record["name"].(string); name == "" {
+			record["name"] = obj.GetName()
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// getApprovalObjects requires the objects approving changes of the XR, and
+// returns their approver records once Crossplane has fetched them
+func (f *Function) getApprovalObjects(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse) ([]interface{}, error) {
+	oxr, err := request.GetObservedCompositeResource(req)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot get observed composite resource"))
+		return nil, err
+	}
+
+	// Approvals are bound to the XR by its UID, which it only has once it's
+	// created
+	uid := string(oxr.Resource.GetUID())
+	if uid == "" {
+		return nil, nil
+	}
+
+	key := approvalObjectsKey(g)
+	requireResources(rsp, key, approvalObjectsSelector(g.ApprovalObjects, g, uid))
+
+	objs, resolved, err := requiredResources(req, key)
+	if err != nil {
+		response.Fatal(rsp, err)
+		return nil, err
+	}
+	if !resolved {
+		f.log.Debug("Waiting for approval objects", "gate", g.Name)
+		return nil, nil
+	}
+
+	return approvalRecords(objs, approvalObjectsField(g.ApprovalObjects)), nil
+}
+
+// validateApprovalObjects checks that ConfigMaps are only read from a single
+// namespace
+func validateApprovalObjects(o *v1beta1.ApprovalObjects) error {
+	if _, kind := approvalObjectsKind(o); kind == "ConfigMap" && o.Namespace == "" {
+		return errors.New("approvalObjects must set a namespace for ConfigMaps")
+	}
+	if _, err := ParseNestedKey(approvalObjectsField(o)); err != nil {
+		return errors.Wrapf(err, "invalid approvalObjects field %q", o.Field)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+)
+
+func TestApprovalObjectsSelector(t *testing.T) {
+	cases := map[string]struct {
+		objects       v1beta1.ApprovalObjects
+		gate          v1beta1.Gate
+		wantKind      string
+		wantNamespace string
+		wantLabels    map[string]string
+	}{
+		"ConfigMap": {
+			objects:       v1beta1.ApprovalObjects{Namespace: "approvals"},
+			wantKind:      "ConfigMap",
+			wantNamespace: "approvals",
+			wantLabels:    map[string]string{xrUIDLabel: "uid"},
+		},
+		"NamedGate": {
+			objects:       v1beta1.ApprovalObjects{Namespace: "approvals", MatchLabels: map[string]string{"team": "platform"}},
+			gate:          v1beta1.Gate{Name: "prod"},
+			wantKind:      "ConfigMap",
+			wantNamespace: "approvals",
+			wantLabels:    map[string]string{xrUIDLabel: "uid", gateLabel: "prod", "team": "platform"},
+		},
+		"MatchLabelsCannotOverrideUID": {
+			objects:    v1beta1.ApprovalObjects{Kind: "Approval", APIVersion: "example.org/v1", MatchLabels: map[string]string{xrUIDLabel: "other"}},
+			wantKind:   "Approval",
+			wantLabels: map[string]string{xrUIDLabel: "uid"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := approvalObjectsSelector(&tc.objects, &tc.gate, "uid")
+			if got.GetKind() != tc.wantKind || got.GetNamespace() != tc.wantNamespace {
+				t.Errorf("approvalObjectsSelector(...): want %s in %q, got %s in %q", tc.wantKind, tc.wantNamespace, got.GetKind(), got.GetNamespace())
+			}
+			if labels := got.GetMatchLabels().GetLabels(); !reflect.DeepEqual(labels, tc.wantLabels) {
+				t.Errorf("approvalObjectsSelector(...): want labels %v, got %v", tc.wantLabels, labels)
+			}
+		})
+	}
+}
+
+func TestApprovalRecords(t *testing.T) {
+	objs := []*unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "bob"},
+			"data":     map[string]interface{}{"group": "security", "hash": "abc"},
+		}},
+		{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "approval-1"},
+			"data":     map[string]interface{}{"name": "alice", "hash": "abc"},
+		}},
+		{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "no-hash"},
+			"data":     map[string]interface{}{"name": "carol"},
+		}},
+		{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "no-data"},
+		}},
+	}
+
+	want := []interface{}{
+		map[string]interface{}{"name": "alice", "hash": "abc"},
+		map[string]interface{}{"name": "bob", "group": "security", "hash": "abc"},
+	}
+	if got := approvalRecords(objs, "data"); !reflect.DeepEqual(got, want) {
+		t.Errorf("approvalRecords(...): want %v, got %v", want, got)
+	}
+}
+
+func TestValidateApprovalObjects(t *testing.T) {
+	cases := map[string]struct {
+		objects v1beta1.ApprovalObjects
+		wantErr bool
+	}{
+		"ConfigMapWithNamespace": {
+			objects: v1beta1.ApprovalObjects{Namespace: "approvals"},
+		},
+		"ConfigMapWithoutNamespace": {
+			objects: v1beta1.ApprovalObjects{},
+			wantErr: true,
+		},
+		"ClusterScopedKind": {
+			objects: v1beta1.ApprovalObjects{APIVersion: "example.org/v1", Kind: "Approval"},
+		},
+		"InvalidField": {
+			objects: v1beta1.ApprovalObjects{Namespace: "approvals", Field: "data["},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := validateApprovalObjects(&tc.objects)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validateApprovalObjects(...): want error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
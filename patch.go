@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// JSON Patch operations, as defined by RFC 6902.
+const (
+	patchOpAdd     = "add"
+	patchOpRemove  = "remove"
+	patchOpReplace = "replace"
+)
+
+// jsonPatch returns an RFC 6902 JSON Patch that applies the changes to the
+// watched data. Paths are relative to the XR, but the patch is only valid
+// against it if no paths are ignored and the data isn't normalized. The
+// changes must be in the order diffSnapshots returns them, with list elements
+// in index order. Elements removed from the end of a list are
+// removed last to first, so that each operation's index is still valid when
+// it's applied.
+func jsonPatch(changes []change) []interface{} {
+	ops := make([]interface{}, 0, len(changes))
+	for i := 0; i < len(changes); i++ {
+		c := changes[i]
+		segments, err := ParseNestedKey(c.Path)
+		if err != nil {
+			continue
+		}
+
+		if c.Kind == changeRemoved && segments[len(segments)-1].Type == PathSegmentIndex {
+			// Find the run of elements removed from the same list
+			parent := FormatPath(segments[:len(segments)-1])
+			end := i + 1
+			for end < len(changes) && changes[end].Kind == changeRemoved && listParent(changes[end].Path) == parent {
+				end++
+			}
+			for j := end - 1; j >= i; j-- {
+				ops = append(ops, map[string]interface{}{"op": patchOpRemove, "path": jsonPointer(changes[j].Path)})
+			}
+			i = end - 1
+			continue
+		}
+
+		switch c.Kind {
+		case changeAdded:
+			ops = append(ops, map[string]interface{}{"op": patchOpAdd, "path": jsonPointer(c.Path), "value": c.New})
+		case changeRemoved:
+			ops = append(ops, map[string]interface{}{"op": patchOpRemove, "path": jsonPointer(c.Path)})
+		default:
+			ops = append(ops, map[string]interface{}{"op": patchOpReplace, "path": jsonPointer(c.Path), "value": c.New})
+		}
+	}
+	return ops
+}
+
+// listParent returns the path of the list a path selects an element of, or
+// an empty string if it doesn't select a list element
+func listParent(path string) string {
+	segments, err := ParseNestedKey(path)
+	if err != nil || segments[len(segments)-1].Type != PathSegmentIndex {
+		return ""
+	}
+	return FormatPath(segments[:len(segments)-1])
+}
+
+// jsonPointer returns the RFC 6901 JSON Pointer for a concrete path
+func jsonPointer(path string) string {
+	segments, err := ParseNestedKey(path)
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteByte('/')
+		if s.Type == PathSegmentIndex {
+			b.WriteString(strconv.Itoa(s.Index))
+			continue
+		}
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(s.Field))
+	}
+	return b.String()
+}
+
+// mergePatch returns an RFC 7386 JSON Merge Patch that turns the approved
+// data into the pending data, as it is hashed. Merge patches can't address
+// list elements, so no patch is returned if a watched path selects one.
+func mergePatch(approved, pending *snapshot) (map[string]interface{}, bool) {
+	patch := make(map[string]interface{})
+	for _, path := range unionKeys(approved.Fields, pending.Fields) {
+		segments, err := ParseNestedKey(path)
+		if err != nil {
+			return nil, false
+		}
+		for _, s := range segments {
+			if s.Type != PathSegmentField {
+				return nil, false
+			}
+		}
+
+		old, hadOld := approved.Fields[path]
+		now, hasNew := pending.Fields[path]
+
+		var value interface{}
+		switch {
+		case !hasNew:
+			value = nil
+		case !hadOld:
+			value = now
+		default:
+			var changed bool
+			value, changed = mergeValue(old, now)
+			if !changed {
+				continue
+			}
+		}
+
+		// Nest the value under its path
+		node := patch
+		for _, s := range segments[:len(segments)-1] {
+			child, ok := node[s.Field].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[s.Field] = child
+			}
+			node = child
+		}
+		node[segments[len(segments)-1].Field] = value
+	}
+	return patch, true
+}
+
+// mergeValue returns the merge patch that turns the old value into the new
+// one, and whether there is anything to patch. Maps are patched key by key,
+// and any other value is replaced as a whole.
+func mergeValue(old, now interface{}) (interface{}, bool) {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := now.(map[string]interface{})
+	if !oldIsMap || !newIsMap {
+		return now, !sameJSON(old, now)
+	}
+
+	patch := make(map[string]interface{})
+	for _, k := range unionKeys(oldMap, newMap) {
+		o, hadOld := oldMap[k]
+		n, hasNew := newMap[k]
+		switch {
+		case !hasNew:
+			patch[k] = nil
+		case !hadOld:
+			patch[k] = n
+		default:
+			if v, changed := mergeValue(o, n); changed {
+				patch[k] = v
+			}
+		}
+	}
+	return patch, len(patch) > 0
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestJSONPointer(t *testing.T) {
+	cases := map[string]string{
+		"spec.resources.size":                     "/spec/resources/size",
+		"spec.users[1].name":                      "/spec/users/1/name",
+		`metadata.annotations["example.com/a~b"]`: "/metadata/annotations/example.com~1a~0b",
+	}
+
+	for path, want := range cases {
+		if got := jsonPointer(path); got != want {
+			t.Errorf("jsonPointer(%q): want %q, got %q", path, want, got)
+		}
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	changes := []change{
+		{Path: "spec.resources.size", Kind: changeModified, Old: "large", New: "small"},
+		{Path: "spec.resources.tags", Kind: changeAdded, New: map[string]interface{}{"team": "a"}},
+		{Path: "spec.resources.zones[1]", Kind: changeRemoved, Old: "b"},
+		{Path: "spec.resources.zones[2]", Kind: changeRemoved, Old: "c"},
+		{Path: "spec.resources.description", Kind: changeRemoved, Old: "text"},
+	}
+
+	want := []interface{}{
+		map[string]interface{}{"op": "replace", "path": "/spec/resources/size", "value": "small"},
+		map[string]interface{}{"op": "add", "path": "/spec/resources/tags", "value": map[string]interface{}{"team": "a"}},
+		map[string]interface{}{"op": "remove", "path": "/spec/resources/zones/2"},
+		map[string]interface{}{"op": "remove", "path": "/spec/resources/zones/1"},
+		map[string]interface{}{"op": "remove", "path": "/spec/resources/description"},
+	}
+
+	if got := jsonPatch(changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("jsonPatch(...):\nwant %v\ngot  %v", want, got)
+	}
+}
+
+func TestJSONPatchManyListElements(t *testing.T) {
+	// Pattern-matched list elements are watched at their own path, so more
+	// than ten of them must still be patched in index order
+	elements := func(n int) *snapshot {
+		s := &snapshot{Fields: make(map[string]interface{})}
+		for i := 0; i < n; i++ {
+			s.Fields["spec.users["+strconv.Itoa(i)+"]"] = "user-" + strconv.Itoa(i)
+		}
+		return s
+	}
+
+	cases := map[string]struct {
+		approved *snapshot
+		pending  *snapshot
+		want     []interface{}
+	}{
+		"Grow": {
+			approved: elements(9),
+			pending:  elements(12),
+			want: []interface{}{
+				map[string]interface{}{"op": "add", "path": "/spec/users/9", "value": "user-9"},
+				map[string]interface{}{"op": "add", "path": "/spec/users/10", "value": "user-10"},
+				map[string]interface{}{"op": "add", "path": "/spec/users/11", "value": "user-11"},
+			},
+		},
+		"Shrink": {
+			approved: elements(12),
+			pending:  elements(9),
+			want: []interface{}{
+				map[string]interface{}{"op": "remove", "path": "/spec/users/11"},
+				map[string]interface{}{"op": "remove", "path": "/spec/users/10"},
+				map[string]interface{}{"op": "remove", "path": "/spec/users/9"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := jsonPatch(diffSnapshots(tc.approved, tc.pending)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("jsonPatch(...):\nwant %v\ngot  %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	approved := &snapshot{Fields: map[string]interface{}{
+		"spec.resources": map[string]interface{}{
+			"size":        "large",
+			"zones":       []interface{}{"a", "b"},
+			"description": "text",
+			"tags":        map[string]interface{}{"team": "a"},
+		},
+		"spec.networking": map[string]interface{}{"cidr": "10.0.0.0/16"},
+	}}
+	pending := &snapshot{Fields: map[string]interface{}{
+		"spec.resources": map[string]interface{}{
+			"size":  "small",
+			"zones": []interface{}{"a"},
+			"tags":  map[string]interface{}{"team": "a"},
+		},
+	}}
+
+	want := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"networking": nil,
+			"resources": map[string]interface{}{
+				"size":        "small",
+				"zones":       []interface{}{"a"},
+				"description": nil,
+			},
+		},
+	}
+
+	got, ok := mergePatch(approved, pending)
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("mergePatch(...):\nwant %v\ngot  %v (%t)", want, got, ok)
+	}
+
+	// Merge patches can't address list elements
+	if _, ok := mergePatch(&snapshot{Fields: map[string]interface{}{"spec.users[0]": "a"}}, pending); ok {
+		t.Error("mergePatch(...): expected no patch for a path that selects a list element")
+	}
+}
@@ -0,0 +1,724 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// PathSegmentType is the type of a single step in a field path.
+type PathSegmentType int
+
+// Types of path segments.
+const (
+	// PathSegmentField steps into a map key.
+	PathSegmentField PathSegmentType = iota
+
+	// PathSegmentIndex steps into a list element.
+	PathSegmentIndex
+
+	// PathSegmentWildcard steps into every value of a map or list.
+	PathSegmentWildcard
+
+	// PathSegmentFilter steps into every value of a map or list that matches
+	// a filter.
+	PathSegmentFilter
+)
+
+// PathSegment is a single step in a field path.
+type PathSegment struct {
+	// Type of the segment.
+	Type PathSegmentType
+
+	// Field is the map key to step into, for field segments.
+	Field string
+
+	// Index is the list index to step into, for index segments.
+	Index int
+
+	// Filter selects the values to step into, for filter segments.
+	Filter *PathFilter
+}
+
+// PathFilter selects map or list values by comparing one of their fields to a
+// literal value, e.g. [?(@.name=="gpu")].
+type PathFilter struct {
+	// Path is the field to compare, relative to the value being filtered.
+	Path []PathSegment
+
+	// Operator is either == or !=.
+	Operator string
+
+	// Value is the literal to compare to.
+	Value interface{}
+}
+
+// PathMatch is a concrete path matched by a path with wildcards or filters.
+type PathMatch struct {
+	// Path is the concrete path, formatted by FormatPath.
+	Path string
+
+	// Value is the value found at the path.
+	Value interface{}
+}
+
+// ParseNestedKey parses a field path using dot and bracket notation. Fields
+// are separated by dots, list elements are selected with an index in brackets
+// and keys that contain special characters are quoted in brackets, e.g.
+//
+//	spec.resources.users[0].name
+//	metadata.annotations["example.com/tier"]
+//
+// A backslash escapes the next character in both unquoted and quoted keys.
+//
+// Paths may select several values. A * or [*] segment selects every value of
+// a map (in key order) or list, and a filter segment selects the values whose
+// field compares equal (==) or not equal (!=) to a literal, e.g.
+//
+//	spec.resources.*.size
+//	spec.nodePools[?(@.name=="gpu")]
+//
+// Such paths can only be resolved with ExpandPath.
+func ParseNestedKey(key string) ([]PathSegment, error) {
+	p := &pathParser{in: key}
+	return p.path(false)
+}
+
+// path parses a sequence of segments. Relative paths, as used in filters,
+// start with @ and end at the first character that can't continue a path.
+func (p *pathParser) path(relative bool) ([]PathSegment, error) {
+	if relative {
+		if p.done() || p.peek() != '@' {
+			return nil, p.errorf("expected '@'")
+		}
+		p.pos++
+	}
+
+	var segments []PathSegment
+	for !p.done() {
+		switch p.peek() {
+		case '.':
+			// A dot must separate two segments, except in relative paths
+			if len(segments) == 0 && !relative {
+				return nil, p.errorf("unexpected '.'")
+			}
+			p.pos++
+			segment, err := p.field(relative)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment)
+		case '[':
+			segment, err := p.bracket()
+			if err != nil {
+				return nil, err
+			}
+			if relative && segment.Type != PathSegmentField && segment.Type != PathSegmentIndex {
+				return nil, p.errorf("filters can only compare fixed paths")
+			}
+			segments = append(segments, segment)
+		default:
+			if relative {
+				return segments, nil
+			}
+			if len(segments) > 0 {
+				return nil, p.errorf("expected '.' or '['")
+			}
+			segment, err := p.field(false)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment)
+		}
+	}
+
+	if len(segments) == 0 && !relative {
+		return nil, errors.New("invalid key")
+	}
+	return segments, nil
+}
+
+// FormatPath formats path segments in the notation accepted by ParseNestedKey.
+// Keys that can't be written unquoted are written as quoted keys in brackets.
+func FormatPath(segments []PathSegment) string {
+	var b strings.Builder
+	for i, s := range segments {
+		switch s.Type {
+		case PathSegmentIndex:
+			b.WriteString("[" + strconv.Itoa(s.Index) + "]")
+		case PathSegmentWildcard:
+			b.WriteString("[*]")
+		case PathSegmentFilter:
+			literal, _ := json.Marshal(s.Filter.Value)
+			path := FormatPath(s.Filter.Path)
+			if path != "" && path[0] != '[' {
+				path = "." + path
+			}
+			b.WriteString("[?(@" + path + s.Filter.Operator + string(literal) + ")]")
+		case PathSegmentField:
+			if !isPlainField(s.Field) {
+				b.WriteString(`["` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s.Field) + `"]`)
+				continue
+			}
+			if i > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(s.Field)
+		}
+	}
+	return b.String()
+}
+
+// isPlainField returns true if a key can be written without quoting
+func isPlainField(field string) bool {
+	return field != "" && field != "*" && !strings.ContainsAny(field, `.[]\"'()=!@ `)
+}
+
+// IsPathPattern returns true if the path can match more than one value
+func IsPathPattern(segments []PathSegment) bool {
+	for _, s := range segments {
+		if s.Type == PathSegmentWildcard || s.Type == PathSegmentFilter {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandPath returns every concrete path that matches a path with wildcards or
+// filters, together with its value. Matches are returned in a stable order:
+// maps are walked in key order and lists in index order. A path without
+// wildcards or filters matches at most one value.
+func ExpandPath(data map[string]interface{}, key string) ([]PathMatch, error) {
+	segments, err := ParseNestedKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []PathMatch
+	expandPath(data, segments, nil, &matches)
+	return matches, nil
+}
+
+// expandPath appends the matches of segments below node to matches
+func expandPath(node interface{}, segments, prefix []PathSegment, matches *[]PathMatch) {
+	if len(segments) == 0 {
+		*matches = append(*matches, PathMatch{Path: FormatPath(prefix), Value: node})
+		return
+	}
+
+	s, rest := segments[0], segments[1:]
+	switch s.Type {
+	case PathSegmentField:
+		if m, ok := node.(map[string]interface{}); ok {
+			if v, exists := m[s.Field]; exists {
+				expandPath(v, rest, appendSegment(prefix, s), matches)
+			}
+		}
+	case PathSegmentIndex:
+		if l, ok := node.([]interface{}); ok && s.Index < len(l) {
+			expandPath(l[s.Index], rest, appendSegment(prefix, s), matches)
+		}
+	case PathSegmentWildcard, PathSegmentFilter:
+		for _, child := range children(node) {
+			if s.Type == PathSegmentFilter && !s.Filter.matches(child.value) {
+				continue
+			}
+			expandPath(child.value, rest, appendSegment(prefix, child.segment), matches)
+		}
+	}
+}
+
+// appendSegment returns a new path with the segment appended, leaving the
+// supplied path untouched
+func appendSegment(path []PathSegment, s PathSegment) []PathSegment {
+	out := make([]PathSegment, len(path), len(path)+1)
+	copy(out, path)
+	return append(out, s)
+}
+
+// child is a value of a map or list, and the segment that selects it
+type child struct {
+	segment PathSegment
+	value   interface{}
+}
+
+// children returns the values of a map in key order, or of a list in index
+// order. Any other value has no children.
+func children(node interface{}) []child {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(n))
+		for k := range n {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		out := make([]child, 0, len(keys))
+		for _, k := range keys {
+			out = append(out, child{segment: PathSegment{Type: PathSegmentField, Field: k}, value: n[k]})
+		}
+		return out
+	case []interface{}:
+		out := make([]child, 0, len(n))
+		for i, v := range n {
+			out = append(out, child{segment: PathSegment{Type: PathSegmentIndex, Index: i}, value: v})
+		}
+		return out
+	}
+	return nil
+}
+
+// matches returns true if the value passes the filter. A value that doesn't
+// have the filtered field only passes a != filter.
+func (f *PathFilter) matches(value interface{}) bool {
+	var found []PathMatch
+	expandPath(value, f.Path, nil, &found)
+
+	equal := len(found) == 1 && reflect.DeepEqual(found[0].Value, f.Value)
+	if f.Operator == "!=" {
+		return !equal
+	}
+	return equal
+}
+
+// GetNestedValue retrieves a nested value from a map using a field path. Paths
+// with wildcards or filters must be resolved with ExpandPath instead.
+func GetNestedValue(data map[string]interface{}, key string) (interface{}, bool, error) {
+	segments, err := ParseNestedKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if IsPathPattern(segments) {
+		return nil, false, errors.Errorf("key %q can match more than one value", key)
+	}
+
+	currentValue := interface{}(data)
+	for _, s := range segments {
+		switch s.Type {
+		case PathSegmentField:
+			nestedMap, ok := currentValue.(map[string]interface{})
+			if !ok {
+				return nil, false, nil
+			}
+			nextValue, exists := nestedMap[s.Field]
+			if !exists {
+				return nil, false, nil
+			}
+			currentValue = nextValue
+		case PathSegmentIndex:
+			list, ok := currentValue.([]interface{})
+			if !ok || s.Index >= len(list) {
+				return nil, false, nil
+			}
+			currentValue = list[s.Index]
+		}
+	}
+
+	return currentValue, true, nil
+}
+
+// SetNestedValue sets a value to a nested key from a map using a field path.
+// Missing maps and list elements along the path are created. Lists are padded
+// with nil elements if the index is beyond their end.
+func SetNestedValue(root map[string]interface{}, key string, value interface{}) error {
+	segments, err := ParseNestedKey(key)
+	if err != nil {
+		return err
+	}
+
+	if segments[0].Type != PathSegmentField {
+		return errors.Errorf("key %q must start with a field", key)
+	}
+
+	if IsPathPattern(segments) {
+		return errors.Errorf("key %q can match more than one value", key)
+	}
+
+	_, err = setPath(root, segments, value)
+	return err
+}
+
+// DeleteNestedValue removes the value at a field path from a map. Removing a
+// list element shifts the elements after it. Removing a value that doesn't
+// exist is not an error.
+func DeleteNestedValue(root map[string]interface{}, key string) error {
+	segments, err := ParseNestedKey(key)
+	if err != nil {
+		return err
+	}
+
+	if segments[0].Type != PathSegmentField {
+		return errors.Errorf("key %q must start with a field", key)
+	}
+
+	if IsPathPattern(segments) {
+		return errors.Errorf("key %q can match more than one value", key)
+	}
+
+	deletePath(root, segments)
+	return nil
+}
+
+// deletePath removes the value at the path below the supplied node, and
+// returns the node. The node may be a shorter list if an element was removed.
+func deletePath(node interface{}, segments []PathSegment) interface{} {
+	s, last := segments[0], len(segments) == 1
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, exists := n[s.Field]
+		if s.Type != PathSegmentField || !exists {
+			return node
+		}
+		if last {
+			delete(n, s.Field)
+			return n
+		}
+		n[s.Field] = deletePath(child, segments[1:])
+		return n
+	case []interface{}:
+		if s.Type != PathSegmentIndex || s.Index >= len(n) {
+			return node
+		}
+		if last {
+			return append(n[:s.Index:s.Index], n[s.Index+1:]...)
+		}
+		n[s.Index] = deletePath(n[s.Index], segments[1:])
+		return n
+	}
+	return node
+}
+
+// IsPathWithin returns true if the path is equal to or nested within the
+// parent path. Both paths must be concrete paths.
+func IsPathWithin(path, parent string) bool {
+	p, err := ParseNestedKey(path)
+	if err != nil {
+		return false
+	}
+	pp, err := ParseNestedKey(parent)
+	if err != nil || len(pp) > len(p) {
+		return false
+	}
+	return reflect.DeepEqual(p[:len(pp)], pp)
+}
+
+// SortPaths sorts concrete paths segment by segment, so that list elements
+// are in index order, e.g. x[2] before x[10]. Fields sort before indexes at
+// the same depth, and paths that can't be parsed sort by their text.
+func SortPaths(paths []string) {
+	parsed := make(map[string][]PathSegment, len(paths))
+	for _, path := range paths {
+		if segments, err := ParseNestedKey(path); err == nil {
+			parsed[path] = segments
+		}
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		a, okA := parsed[paths[i]]
+		b, okB := parsed[paths[j]]
+		if !okA || !okB {
+			return paths[i] < paths[j]
+		}
+		return comparePaths(a, b) < 0
+	})
+}
+
+// comparePaths compares two concrete paths segment by segment. A path sorts
+// before the paths nested within it.
+func comparePaths(a, b []PathSegment) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		sa, sb := a[i], b[i]
+		switch {
+		case sa.Type != sb.Type:
+			return int(sa.Type) - int(sb.Type)
+		case sa.Type == PathSegmentIndex && sa.Index != sb.Index:
+			return sa.Index - sb.Index
+		case sa.Field != sb.Field:
+			return strings.Compare(sa.Field, sb.Field)
+		}
+	}
+	return len(a) - len(b)
+}
+
+// setPath sets the value at the path below the supplied node, and returns the
+// node. The node may be a new map or list if the supplied one was nil or had
+// to grow.
+func setPath(node interface{}, segments []PathSegment, value interface{}) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+
+	s := segments[0]
+	switch s.Type {
+	case PathSegmentField:
+		m, ok := node.(map[string]interface{})
+		if node == nil {
+			m, ok = make(map[string]interface{}), true
+		}
+		if !ok {
+			return nil, errors.Errorf("key %q exists but is not a map", s.Field)
+		}
+
+		child, err := setPath(m[s.Field], segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		m[s.Field] = child
+		return m, nil
+	case PathSegmentIndex:
+		l, ok := node.([]interface{})
+		if node == nil {
+			l, ok = []interface{}{}, true
+		}
+		if !ok {
+			return nil, errors.Errorf("index [%d] used on a value that is not a list", s.Index)
+		}
+
+		for len(l) <= s.Index {
+			l = append(l, nil)
+		}
+
+		child, err := setPath(l[s.Index], segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		l[s.Index] = child
+		return l, nil
+	}
+
+	return nil, errors.Errorf("unsupported path segment type %d", s.Type)
+}
+
+// trimStatusPrefix removes a leading status segment from a field path, so the
+// path can be resolved against the XR status. Paths that can't be parsed are
+// returned unchanged for the caller to report.
+func trimStatusPrefix(field string) string {
+	segments, err := ParseNestedKey(field)
+	if err != nil || len(segments) < 2 {
+		return field
+	}
+
+	if segments[0].Type != PathSegmentField || segments[0].Field != "status" {
+		return field
+	}
+
+	return FormatPath(segments[1:])
+}
+
+// pathParser parses a field path one segment at a time
+type pathParser struct {
+	in  string
+	pos int
+}
+
+func (p *pathParser) done() bool {
+	return p.pos >= len(p.in)
+}
+
+func (p *pathParser) peek() byte {
+	return p.in[p.pos]
+}
+
+func (p *pathParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("invalid key %q at position %d: "+format, append([]interface{}{p.in, p.pos}, args...)...)
+}
+
+// field parses an unquoted key up to the next '.' or '['. An unescaped * is
+// a wildcard. Keys in relative paths also end at the operator of a filter.
+func (p *pathParser) field(relative bool) (PathSegment, error) {
+	var b strings.Builder
+	escaped := false
+	for !p.done() {
+		c := p.peek()
+		if c == '.' || c == '[' {
+			break
+		}
+		if relative && (c == '=' || c == '!' || c == ')' || c == ' ') {
+			break
+		}
+		if c == ']' {
+			return PathSegment{}, p.errorf("unexpected ']'")
+		}
+		if c == '\\' {
+			p.pos++
+			if p.done() {
+				return PathSegment{}, p.errorf("unterminated escape")
+			}
+			c = p.peek()
+			escaped = true
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+
+	if b.Len() == 0 {
+		return PathSegment{}, p.errorf("empty field")
+	}
+	if b.String() == "*" && !escaped {
+		if relative {
+			return PathSegment{}, p.errorf("filters can only compare fixed paths")
+		}
+		return PathSegment{Type: PathSegmentWildcard}, nil
+	}
+	return PathSegment{Type: PathSegmentField, Field: b.String()}, nil
+}
+
+// bracket parses an index or quoted key in brackets
+func (p *pathParser) bracket() (PathSegment, error) {
+	// Skip the opening bracket
+	p.pos++
+	if p.done() {
+		return PathSegment{}, p.errorf("unterminated '['")
+	}
+
+	var segment PathSegment
+	switch c := p.peek(); {
+	case c == '*':
+		p.pos++
+		segment = PathSegment{Type: PathSegmentWildcard}
+	case c == '?':
+		filter, err := p.filter()
+		if err != nil {
+			return PathSegment{}, err
+		}
+		segment = PathSegment{Type: PathSegmentFilter, Filter: filter}
+	case c == '"' || c == '\'':
+		field, err := p.quoted(c)
+		if err != nil {
+			return PathSegment{}, err
+		}
+		segment = PathSegment{Type: PathSegmentField, Field: field}
+	default:
+		end := strings.IndexByte(p.in[p.pos:], ']')
+		if end < 0 {
+			return PathSegment{}, p.errorf("unterminated '['")
+		}
+		index, err := strconv.Atoi(p.in[p.pos : p.pos+end])
+		if err != nil || index < 0 {
+			return PathSegment{}, p.errorf("invalid index %q", p.in[p.pos:p.pos+end])
+		}
+		p.pos += end
+		segment = PathSegment{Type: PathSegmentIndex, Index: index}
+	}
+
+	if p.done() || p.peek() != ']' {
+		return PathSegment{}, p.errorf("expected ']'")
+	}
+	p.pos++
+	return segment, nil
+}
+
+// filter parses a filter of the form ?(@.field==literal)
+func (p *pathParser) filter() (*PathFilter, error) {
+	if !strings.HasPrefix(p.in[p.pos:], "?(") {
+		return nil, p.errorf("expected '?('")
+	}
+	p.pos += 2
+
+	p.skipSpaces()
+	path, err := p.path(true)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	var op string
+	switch {
+	case strings.HasPrefix(p.in[p.pos:], "=="):
+		op = "=="
+	case strings.HasPrefix(p.in[p.pos:], "!="):
+		op = "!="
+	default:
+		return nil, p.errorf("expected '==' or '!='")
+	}
+	p.pos += len(op)
+
+	p.skipSpaces()
+	value, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if p.done() || p.peek() != ')' {
+		return nil, p.errorf("expected ')'")
+	}
+	p.pos++
+
+	return &PathFilter{Path: path, Operator: op, Value: value}, nil
+}
+
+// literal parses a quoted string, number, boolean or null
+func (p *pathParser) literal() (interface{}, error) {
+	if p.done() {
+		return nil, p.errorf("expected a literal")
+	}
+
+	if c := p.peek(); c == '"' || c == '\'' {
+		return p.quoted(c)
+	}
+
+	end := strings.IndexAny(p.in[p.pos:], " )")
+	if end < 0 {
+		return nil, p.errorf("unterminated filter")
+	}
+
+	raw := p.in[p.pos : p.pos+end]
+	switch raw {
+	case "true":
+		p.pos += end
+		return true, nil
+	case "false":
+		p.pos += end
+		return false, nil
+	case "null":
+		p.pos += end
+		return nil, nil
+	}
+
+	// Numbers are compared as float64, like numbers decoded from JSON
+	number, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, p.errorf("invalid literal %q", raw)
+	}
+	p.pos += end
+	return number, nil
+}
+
+// skipSpaces skips spaces within a filter
+func (p *pathParser) skipSpaces() {
+	for !p.done() && p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+// quoted parses a key quoted with the supplied quote character
+func (p *pathParser) quoted(quote byte) (string, error) {
+	// Skip the opening quote
+	p.pos++
+
+	var b strings.Builder
+	for !p.done() {
+		c := p.peek()
+		p.pos++
+		switch c {
+		case quote:
+			return b.String(), nil
+		case '\\':
+			if p.done() {
+				return "", p.errorf("unterminated escape")
+			}
+			b.WriteByte(p.peek())
+			p.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", p.errorf("unterminated quoted key")
+}
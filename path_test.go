@@ -0,0 +1,377 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNestedKey(t *testing.T) {
+	cases := map[string]struct {
+		key     string
+		want    []PathSegment
+		wantErr bool
+	}{
+		"Fields": {
+			key: "spec.resources.size",
+			want: []PathSegment{
+				{Type: PathSegmentField, Field: "spec"},
+				{Type: PathSegmentField, Field: "resources"},
+				{Type: PathSegmentField, Field: "size"},
+			},
+		},
+		"WholeSection": {
+			key:  "spec",
+			want: []PathSegment{{Type: PathSegmentField, Field: "spec"}},
+		},
+		"Index": {
+			key: "spec.resources.users[0].name",
+			want: []PathSegment{
+				{Type: PathSegmentField, Field: "spec"},
+				{Type: PathSegmentField, Field: "resources"},
+				{Type: PathSegmentField, Field: "users"},
+				{Type: PathSegmentIndex, Index: 0},
+				{Type: PathSegmentField, Field: "name"},
+			},
+		},
+		"QuotedKey": {
+			key: `metadata.annotations["example.com/tier"]`,
+			want: []PathSegment{
+				{Type: PathSegmentField, Field: "metadata"},
+				{Type: PathSegmentField, Field: "annotations"},
+				{Type: PathSegmentField, Field: "example.com/tier"},
+			},
+		},
+		"SingleQuotedKeyWithEscapes": {
+			key: `data['it\'s \\ here']`,
+			want: []PathSegment{
+				{Type: PathSegmentField, Field: "data"},
+				{Type: PathSegmentField, Field: `it's \ here`},
+			},
+		},
+		"EscapedDot": {
+			key: `labels.app\.kubernetes\.io/name`,
+			want: []PathSegment{
+				{Type: PathSegmentField, Field: "labels"},
+				{Type: PathSegmentField, Field: "app.kubernetes.io/name"},
+			},
+		},
+		"Wildcards": {
+			key: "spec.resources.*.size[*]",
+			want: []PathSegment{
+				{Type: PathSegmentField, Field: "spec"},
+				{Type: PathSegmentField, Field: "resources"},
+				{Type: PathSegmentWildcard},
+				{Type: PathSegmentField, Field: "size"},
+				{Type: PathSegmentWildcard},
+			},
+		},
+		"EscapedWildcard": {
+			key: `data.\*`,
+			want: []PathSegment{
+				{Type: PathSegmentField, Field: "data"},
+				{Type: PathSegmentField, Field: "*"},
+			},
+		},
+		"Filter": {
+			key: `spec.nodePools[?(@.name=="gpu")].size`,
+			want: []PathSegment{
+				{Type: PathSegmentField, Field: "spec"},
+				{Type: PathSegmentField, Field: "nodePools"},
+				{Type: PathSegmentFilter, Filter: &PathFilter{
+					Path:     []PathSegment{{Type: PathSegmentField, Field: "name"}},
+					Operator: "==",
+					Value:    "gpu",
+				}},
+				{Type: PathSegmentField, Field: "size"},
+			},
+		},
+		"FilterWithSpacesAndNumber": {
+			key: `spec.nodePools[?( @.config["min.count"] != 3 )]`,
+			want: []PathSegment{
+				{Type: PathSegmentField, Field: "spec"},
+				{Type: PathSegmentField, Field: "nodePools"},
+				{Type: PathSegmentFilter, Filter: &PathFilter{
+					Path: []PathSegment{
+						{Type: PathSegmentField, Field: "config"},
+						{Type: PathSegmentField, Field: "min.count"},
+					},
+					Operator: "!=",
+					Value:    float64(3),
+				}},
+			},
+		},
+		"FilterWithoutOperator": {
+			key:     `spec.nodePools[?(@.name)]`,
+			wantErr: true,
+		},
+		"FilterOnPattern": {
+			key:     `spec.nodePools[?(@.*=="gpu")]`,
+			wantErr: true,
+		},
+		"Empty": {
+			key:     "",
+			wantErr: true,
+		},
+		"EmptyField": {
+			key:     "spec..resources",
+			wantErr: true,
+		},
+		"UnterminatedBracket": {
+			key:     "spec.users[0",
+			wantErr: true,
+		},
+		"UnterminatedQuote": {
+			key:     `metadata.annotations["example.com/tier]`,
+			wantErr: true,
+		},
+		"InvalidIndex": {
+			key:     "spec.users[-1]",
+			wantErr: true,
+		},
+		"MissingSeparator": {
+			key:     "spec.users[0]name",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseNestedKey(tc.key)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("ParseNestedKey(%q): expected error but got: %v", tc.key, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseNestedKey(%q): unexpected error: %v", tc.key, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseNestedKey(%q): want %v, got %v", tc.key, tc.want, got)
+			}
+
+			// Formatting the segments must round trip
+			again, err := ParseNestedKey(FormatPath(got))
+			if err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("ParseNestedKey(FormatPath(%v)) = %v, %v: expected round trip", got, again, err)
+			}
+		})
+	}
+}
+
+func TestGetNestedValue(t *testing.T) {
+	data := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				"example.com/tier": "gold",
+			},
+		},
+		"spec": map[string]interface{}{
+			"users": []interface{}{
+				map[string]interface{}{"name": "alice"},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		key        string
+		want       interface{}
+		wantExists bool
+	}{
+		"QuotedKey":       {key: `metadata.annotations["example.com/tier"]`, want: "gold", wantExists: true},
+		"ListElement":     {key: "spec.users[0].name", want: "alice", wantExists: true},
+		"IndexOutOfRange": {key: "spec.users[1].name"},
+		"IndexIntoMap":    {key: "spec[0]"},
+		"MissingField":    {key: "spec.groups"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, exists, err := GetNestedValue(data, tc.key)
+			if err != nil {
+				t.Fatalf("GetNestedValue(%q): unexpected error: %v", tc.key, err)
+			}
+			if exists != tc.wantExists || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("GetNestedValue(%q): want %v, %t, got %v, %t", tc.key, tc.want, tc.wantExists, got, exists)
+			}
+		})
+	}
+}
+
+func TestSetNestedValue(t *testing.T) {
+	root := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"users": []interface{}{
+				map[string]interface{}{"name": "alice"},
+			},
+		},
+	}
+
+	if err := SetNestedValue(root, "spec.users[2].name", "carol"); err != nil {
+		t.Fatalf("SetNestedValue: unexpected error: %v", err)
+	}
+	if err := SetNestedValue(root, `metadata.annotations["example.com/tier"]`, "gold"); err != nil {
+		t.Fatalf("SetNestedValue: unexpected error: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				"example.com/tier": "gold",
+			},
+		},
+		"spec": map[string]interface{}{
+			"users": []interface{}{
+				map[string]interface{}{"name": "alice"},
+				nil,
+				map[string]interface{}{"name": "carol"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(root, want) {
+		t.Errorf("SetNestedValue: want %v, got %v", want, root)
+	}
+
+	if err := SetNestedValue(root, "spec.users.name", "dave"); err == nil {
+		t.Error("SetNestedValue: expected error setting a field on a list but got none")
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	data := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"resources": map[string]interface{}{
+				"db":    map[string]interface{}{"size": "large"},
+				"cache": map[string]interface{}{"size": "small"},
+				"queue": map[string]interface{}{"replicas": float64(3)},
+			},
+			"nodePools": []interface{}{
+				map[string]interface{}{"name": "cpu", "count": float64(3)},
+				map[string]interface{}{"name": "gpu", "count": float64(1)},
+				map[string]interface{}{"count": float64(2)},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		key  string
+		want []PathMatch
+	}{
+		"MapWildcardInKeyOrder": {
+			key: "spec.resources.*.size",
+			want: []PathMatch{
+				{Path: "spec.resources.cache.size", Value: "small"},
+				{Path: "spec.resources.db.size", Value: "large"},
+			},
+		},
+		"ListWildcard": {
+			key: "spec.nodePools[*].name",
+			want: []PathMatch{
+				{Path: "spec.nodePools[0].name", Value: "cpu"},
+				{Path: "spec.nodePools[1].name", Value: "gpu"},
+			},
+		},
+		"EqualsFilter": {
+			key: `spec.nodePools[?(@.name=="gpu")].count`,
+			want: []PathMatch{
+				{Path: "spec.nodePools[1].count", Value: float64(1)},
+			},
+		},
+		"NotEqualsFilterIncludesMissingFields": {
+			key: `spec.nodePools[?(@.name!="gpu")].count`,
+			want: []PathMatch{
+				{Path: "spec.nodePools[0].count", Value: float64(3)},
+				{Path: "spec.nodePools[2].count", Value: float64(2)},
+			},
+		},
+		"NumberFilter": {
+			key: `spec.nodePools[?(@.count==3)].name`,
+			want: []PathMatch{
+				{Path: "spec.nodePools[0].name", Value: "cpu"},
+			},
+		},
+		"NoMatches": {
+			key: "spec.missing.*",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ExpandPath(data, tc.key)
+			if err != nil {
+				t.Fatalf("ExpandPath(%q): unexpected error: %v", tc.key, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ExpandPath(%q): want %v, got %v", tc.key, tc.want, got)
+			}
+		})
+	}
+
+	if _, _, err := GetNestedValue(data, "spec.resources.*.size"); err == nil {
+		t.Error("GetNestedValue: expected error for a path with wildcards but got none")
+	}
+}
+
+func TestDeleteNestedValue(t *testing.T) {
+	root := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"tags": []interface{}{"a", "b", "c"},
+			"resources": map[string]interface{}{
+				"description": "text",
+				"size":        "large",
+			},
+		},
+	}
+
+	for _, key := range []string{"spec.tags[1]", "spec.resources.description", "spec.missing.field", "spec.tags[7]"} {
+		if err := DeleteNestedValue(root, key); err != nil {
+			t.Fatalf("DeleteNestedValue(%q): unexpected error: %v", key, err)
+		}
+	}
+
+	want := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"tags": []interface{}{"a", "c"},
+			"resources": map[string]interface{}{
+				"size": "large",
+			},
+		},
+	}
+	if !reflect.DeepEqual(root, want) {
+		t.Errorf("DeleteNestedValue: want %v, got %v", want, root)
+	}
+}
+
+func TestIsPathWithin(t *testing.T) {
+	cases := map[string]struct {
+		path   string
+		parent string
+		want   bool
+	}{
+		"Equal":          {path: "spec.resources", parent: "spec.resources", want: true},
+		"Nested":         {path: "spec.resources.db.tags", parent: "spec.resources", want: true},
+		"NestedInList":   {path: "spec.users[0].name", parent: "spec.users", want: true},
+		"QuotedEqual":    {path: `spec["resources"].tags`, parent: "spec.resources", want: true},
+		"SharedPrefix":   {path: "spec.resourcesExtra", parent: "spec.resources", want: false},
+		"Parent":         {path: "spec", parent: "spec.resources", want: false},
+		"DifferentIndex": {path: "spec.users[1]", parent: "spec.users[0]", want: false},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := IsPathWithin(tc.path, tc.parent); got != tc.want {
+				t.Errorf("IsPathWithin(%q, %q): want %t, got %t", tc.path, tc.parent, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSortPaths(t *testing.T) {
+	paths := []string{"spec.users[10]", "spec.users[2].name", "spec.users", "spec.name", "spec.users[2]", `spec["a b"]`}
+	want := []string{`spec["a b"]`, "spec.name", "spec.users", "spec.users[2]", "spec.users[2].name", "spec.users[10]"}
+
+	SortPaths(paths)
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("SortPaths(...):\nwant %v\ngot  %v", want, paths)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+// pausedAnnotation pauses reconciliation of a managed resource
+const pausedAnnotation = "crossplane.io/paused"
+
+// affectedResources returns the desired composed resources that are new, or
+// whose desired state changed since the last approval, sorted
+func affectedResources(hashes, approved map[string]string) []string {
+	var affected []string
+	for name, hash := range hashes {
+		if approved[name] == "" || !sameHash(approved[name], hash) {
+			affected = append(affected, name)
+		}
+	}
+	sort.Strings(affected)
+	return affected
+}
+
+// setPaused sets the paused annotation of a composed resource to the supplied
+// value
+func setPaused(obj map[string]interface{}, paused string) {
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = make(map[string]interface{})
+		obj["metadata"] = metadata
+	}
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		annotations = make(map[string]interface{})
+		metadata["annotations"] = annotations
+	}
+	annotations[pausedAnnotation] = paused
+}
+
+// pauseDecisions are the values of the paused annotation to set on desired
+// composed resources, keyed by resource name. Gates decide independently, so
+// their decisions are merged and a resource paused by any gate stays paused.
+type pauseDecisions map[string]string
+
+// pause pauses the supplied resources
+func (d pauseDecisions) pause(names []string) {
+	for _, name := range names {
+		d[name] = "true"
+	}
+}
+
+// unpause unpauses the supplied resources, unless a gate pauses them
+func (d pauseDecisions) unpause(names []string) {
+	for _, name := range names {
+		if d[name] != "true" {
+			d[name] = "false"
+		}
+	}
+}
+
+// apply sets the paused annotation of the desired composed resources
+func (d pauseDecisions) apply(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse) error {
+	var paused, unpaused []string
+	for name, value := range d {
+		if value == "true" {
+			paused = append(paused, name)
+			continue
+		}
+		unpaused = append(unpaused, name)
+	}
+
+	if err := annotateResources(req, rsp, unpaused, "false"); err != nil {
+		return errors.Wrap(err, "cannot unpause composed resources")
+	}
+	return errors.Wrap(annotateResources(req, rsp, paused, "true"), "cannot pause composed resources")
+}
+
+// annotateResources sets the paused annotation of the supplied desired
+// composed resources
+func annotateResources(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse, names []string, paused string) error {
+	resources := writableResources(req, rsp)
+	for _, name := range names {
+		r, ok := resources[name]
+		if !ok {
+			continue
+		}
+		obj := r.GetResource().AsMap()
+		setPaused(obj, paused)
+		if err := setDesiredResource(resources, name, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pauseResources decides to pause the desired composed resources affected by
+// the pending change, and returns their names
+func (f *Function) pauseResources(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse, state *approvalState, pauses pauseDecisions) ([]string, error) {
+	approvedHashes, err := f.getApprovedResourceHashes(req, g, state, rsp)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := f.getStatusStrings(req, *g.PausedResourcesField, rsp)
+	if err != nil {
+		return nil, err
+	}
+
+	paused := affectedResources(state.ResourceHashes, approvedHashes)
+	if len(paused) == 0 && len(previous) == 0 {
+		return nil, nil
+	}
+
+	// Resources paused on an earlier run that the change no longer affects
+	// can go back to reconciling
+	isPaused := make(map[string]bool, len(paused))
+	for _, name := range paused {
+		isPaused[name] = true
+	}
+	var unaffected []string
+	for _, name := range previous {
+		if !isPaused[name] {
+			unaffected = append(unaffected, name)
+		}
+	}
+
+	pauses.unpause(unaffected)
+	pauses.pause(paused)
+
+	// Remember what we paused, so we unpause exactly those resources once the
+	// change is approved
+	names := make([]interface{}, 0, len(paused))
+	for _, name := range paused {
+		names = append(names, name)
+	}
+	if err := f.setStatusFields(rsp, map[string]interface{}{*g.PausedResourcesField: names}); err != nil {
+		return nil, err
+	}
+	return paused, nil
+}
+
+// unpauseResources decides to unpause the composed resources that were paused
+// while the approved change waited, unless another gate pauses them. The
+// annotation is set to "false" rather than removed, so that it's cleared no
+// matter how the resources are applied.
+func (f *Function) unpauseResources(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse, pauses pauseDecisions) error {
+	paused, err := f.getStatusStrings(req, *g.PausedResourcesField, rsp)
+	if err != nil || len(paused) == 0 {
+		return err
+	}
+
+	pauses.unpause(paused)
+	f.log.Info("Unpausing composed resources", "gate", g.Name, "resources", paused)
+	return nil
+}
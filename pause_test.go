@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAffectedResources(t *testing.T) {
+	hashes := map[string]string{
+		"db":     "sha256:v1:new",
+		"bucket": "sha256:v1:same",
+		"queue":  "sha256:v1:queue",
+	}
+	approved := map[string]string{
+		"db":     "sha256:v1:old",
+		"bucket": "sha256:v1:same",
+	}
+
+	// New resources are paused too, so they aren't created until approved
+	want := []string{"db", "queue"}
+	if got := affectedResources(hashes, approved); !reflect.DeepEqual(got, want) {
+		t.Errorf("affectedResources(...): want %v, got %v", want, got)
+	}
+}
+
+func TestSetPaused(t *testing.T) {
+	cases := map[string]struct {
+		obj  map[string]interface{}
+		want map[string]interface{}
+	}{
+		"NoMetadata": {
+			obj: map[string]interface{}{"kind": "Instance"},
+			want: map[string]interface{}{
+				"kind": "Instance",
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{pausedAnnotation: "true"},
+				},
+			},
+		},
+		"ExistingAnnotations": {
+			obj: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name":        "db",
+					"annotations": map[string]interface{}{"team": "data", pausedAnnotation: "false"},
+				},
+			},
+			want: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name":        "db",
+					"annotations": map[string]interface{}{"team": "data", pausedAnnotation: "true"},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			setPaused(tc.obj, "true")
+			if !reflect.DeepEqual(tc.obj, tc.want) {
+				t.Errorf("setPaused(...): want %v, got %v", tc.want, tc.obj)
+			}
+		})
+	}
+}
+
+func TestPauseDecisions(t *testing.T) {
+	cases := map[string]struct {
+		decide func(d pauseDecisions)
+		want   pauseDecisions
+	}{
+		"PauseThenUnpause": {
+			decide: func(d pauseDecisions) {
+				d.pause([]string{"db"})
+				d.unpause([]string{"db", "bucket"})
+			},
+			want: pauseDecisions{"db": "true", "bucket": "false"},
+		},
+		"UnpauseThenPause": {
+			decide: func(d pauseDecisions) {
+				d.unpause([]string{"db", "bucket"})
+				d.pause([]string{"db"})
+			},
+			want: pauseDecisions{"db": "true", "bucket": "false"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			d := pauseDecisions{}
+			tc.decide(d)
+			if !reflect.DeepEqual(d, tc.want) {
+				t.Errorf("pauseDecisions: want %v, got %v", tc.want, d)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// approverRecord is an approval given by a single approver
+type approverRecord struct {
+	// Name identifies the approver
+	Name string
+
+	// Group is the group the approver approves for
+	Group string
+
+	// Hash is the hash of the change the approver approves
+	Hash string
+
+	// Timestamp is when the approval was given. It's only informational.
+	Timestamp string
+
+	// KeyID identifies the key the approval is signed with, if it's signed
+	KeyID string
+
+	// Expires is when a signed approval expires
+	Expires string
+
+	// Signature is the base64 encoded signature of the approval
+	Signature string
+}
+
+// parseApproverRecords parses the list of approver records in an approval
+// field. Every record must name its approver and the hash it approves.
+func parseApproverRecords(values []interface{}) ([]approverRecord, error) {
+	records := make([]approverRecord, 0, len(values))
+	for i, v := range values {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("approval %d is not an approver record", i)
+		}
+
+		var r approverRecord
+		r.Name, _ = m["name"].(string)
+		r.Group, _ = m["group"].(string)
+		r.Hash, _ = m["hash"].(string)
+		r.Timestamp, _ = m["timestamp"].(string)
+		r.KeyID, _ = m["keyId"].(string)
+		r.Expires, _ = m["expires"].(string)
+		r.Signature, _ = m["signature"].(string)
+
+		if r.Name == "" {
+			return nil, errors.Errorf("approval %d has no name", i)
+		}
+		if r.Hash == "" {
+			return nil, errors.Errorf("approval %d by %s has no hash", i, r.Name)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// defaultQuorum is the quorum of approver records if the gate doesn't set one
+var defaultQuorum = v1beta1.Quorum{Approvals: 1}
+
+// quorumProgress describes how much of a quorum has been collected
+type quorumProgress struct {
+	// Approvers are the distinct approvers of the pending change, sorted
+	Approvers []string
+
+	// Met is true if the approvers satisfy the quorum
+	Met bool
+
+	// Progress describes the approvals collected, e.g. "1/2 approvals
+	// collected, 0/1 from group security"
+	Progress string
+}
+
+// evaluateQuorum counts the distinct approvers whose records approve the
+// pending hash. An approver who approved several times only counts once, and
+// counts towards every group they approved for.
+func evaluateQuorum(records []approverRecord, q *v1beta1.Quorum, newHash, currentHash, pendingHash string) quorumProgress {
+	approvers := make(map[string]bool)
+	members := make(map[string]map[string]bool)
+	for _, r := range records {
+		if !matchesHash(r.Hash, newHash, currentHash, pendingHash) {
+			continue
+		}
+		approvers[r.Name] = true
+		if members[r.Group] == nil {
+			members[r.Group] = make(map[string]bool)
+		}
+		members[r.Group][r.Name] = true
+	}
+
+	p := quorumProgress{Met: len(approvers) >= q.Approvals}
+	for name := range approvers {
+		p.Approvers = append(p.Approvers, name)
+	}
+	sort.Strings(p.Approvers)
+
+	progress := []string{fmt.Sprintf("%d/%d approvals collected", len(approvers), q.Approvals)}
+	for _, group := range q.Groups {
+		n := len(members[group.Name])
+		if n < group.Approvals {
+			p.Met = false
+		}
+		progress = append(progress, fmt.Sprintf("%d/%d from group %s", n, group.Approvals, group.Name))
+	}
+	p.Progress = strings.Join(progress, ", ")
+
+	return p
+}
+
+// validateQuorum checks that a quorum requires at least one approval, from
+// named groups
+func validateQuorum(q *v1beta1.Quorum) error {
+	if q.Approvals < 1 {
+		return errors.New("quorum must require at least one approval")
+	}
+	for _, group := range q.Groups {
+		if group.Name == "" {
+			return errors.New("quorum group has no name")
+		}
+		if group.Approvals < 1 {
+			return errors.Errorf("quorum group %s must require at least one approval", group.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+)
+
+func TestParseApproverRecords(t *testing.T) {
+	cases := map[string]struct {
+		values  []interface{}
+		want    []approverRecord
+		wantErr bool
+	}{
+		"Valid": {
+			values: []interface{}{
+				map[string]interface{}{"name": "alice", "group": "security", "hash": "sha256:v1:abc", "timestamp": "2026-10-16T10:00:00Z"},
+				map[string]interface{}{"name": "bob", "hash": "abcdef12"},
+			},
+			want: []approverRecord{
+				{Name: "alice", Group: "security", Hash: "sha256:v1:abc", Timestamp: "2026-10-16T10:00:00Z"},
+				{Name: "bob", Hash: "abcdef12"},
+			},
+		},
+		"NotARecord": {
+			values:  []interface{}{"alice"},
+			wantErr: true,
+		},
+		"NoName": {
+			values:  []interface{}{map[string]interface{}{"hash": "sha256:v1:abc"}},
+			wantErr: true,
+		},
+		"NoHash": {
+			values:  []interface{}{map[string]interface{}{"name": "alice"}},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseApproverRecords(tc.values)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseApproverRecords(...): want error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseApproverRecords(...): want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateQuorum(t *testing.T) {
+	const (
+		newHash     = "sha256:v1:1111111111111111"
+		currentHash = "sha256:v1:2222222222222222"
+	)
+	quorum := &v1beta1.Quorum{
+		Approvals: 2,
+		Groups:    []v1beta1.GroupQuorum{{Name: "security", Approvals: 1}},
+	}
+
+	cases := map[string]struct {
+		records []approverRecord
+		want    quorumProgress
+	}{
+		"NoApprovals": {
+			want: quorumProgress{Progress: "0/2 approvals collected, 0/1 from group security"},
+		},
+		"SameApproverTwice": {
+			records: []approverRecord{
+				{Name: "alice", Group: "security", Hash: newHash},
+				{Name: "alice", Group: "security", Hash: newHash},
+			},
+			want: quorumProgress{
+				Approvers: []string{"alice"},
+				Progress:  "1/2 approvals collected, 1/1 from group security",
+			},
+		},
+		"StaleApproval": {
+			records: []approverRecord{
+				{Name: "alice", Group: "security", Hash: newHash},
+				{Name: "bob", Group: "dev", Hash: currentHash},
+			},
+			want: quorumProgress{
+				Approvers: []string{"alice"},
+				Progress:  "1/2 approvals collected, 1/1 from group security",
+			},
+		},
+		"MissingGroup": {
+			records: []approverRecord{
+				{Name: "bob", Group: "dev", Hash: newHash},
+				{Name: "carol", Group: "dev", Hash: "1111111111111111"},
+			},
+			want: quorumProgress{
+				Approvers: []string{"bob", "carol"},
+				Progress:  "2/2 approvals collected, 0/1 from group security",
+			},
+		},
+		"Met": {
+			records: []approverRecord{
+				{Name: "alice", Group: "security", Hash: newHash},
+				{Name: "bob", Group: "dev", Hash: newHash},
+			},
+			want: quorumProgress{
+				Approvers: []string{"alice", "bob"},
+				Met:       true,
+				Progress:  "2/2 approvals collected, 1/1 from group security",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := evaluateQuorum(tc.records, quorum, newHash, currentHash, newHash); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("evaluateQuorum(...): want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// requireResources asks Crossplane to fetch the resources matching the
+// selector, and send them with the next request under the supplied key.
+// Crossplane before v2 only reads the deprecated extra resources, so the
+// requirement is set in both places.
+func requireResources(rsp *fnv1.RunFunctionResponse, key string, sel *fnv1.ResourceSelector) {
+	if rsp.GetRequirements() == nil {
+		rsp.Requirements = &fnv1.Requirements{}
+	}
+	if rsp.Requirements.Resources == nil {
+		rsp.Requirements.Resources = make(map[string]*fnv1.ResourceSelector)
+	}
+	rsp.Requirements.Resources[key] = sel
+
+	if rsp.Requirements.ExtraResources == nil { //nolint:staticcheck // Crossplane before v2 only reads extra resources
+		rsp.Requirements.ExtraResources = make(map[string]*fnv1.ResourceSelector) //nolint:staticcheck // see above
+	}
+	rsp.Requirements.ExtraResources[key] = sel //nolint:staticcheck // see above
+}
+
+// requiredResources returns the resources Crossplane fetched for the supplied
+// key. The bool reports whether Crossplane resolved the requirement yet.
+func requiredResources(req *fnv1.RunFunctionRequest, key string) ([]*unstructured.Unstructured, bool, error) {
+	resources, ok := req.GetRequiredResources()[key]
+	if !ok {
+		resources, ok = req.GetExtraResources()[key] //nolint:staticcheck // Crossplane before v2 only sends extra resources
+	}
+	if !ok {
+		return nil, false, nil
+	}
+
+	out := make([]*unstructured.Unstructured, 0, len(resources.GetItems()))
+	for _, i := range resources.GetItems() {
+		u := &unstructured.Unstructured{}
+		if err := resource.AsObject(i.GetResource(), u); err != nil {
+			return nil, true, errors.Wrapf(err, "cannot parse required resource %s", key)
+		}
+		out = append(out, u)
+	}
+	return out, true, nil
+}
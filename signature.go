@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// signedPayload returns the data an approver signs to approve a change of an
+// XR until the supplied expiry. It covers the approver's name and group, so a
+// signature can't be copied into a record of another approver.
+func signedPayload(uid, hash, expires, name, group string) []byte {
+	return []byte(uid + "\n" + hash + "\n" + expires + "\n" + name + "\n" + group)
+}
+
+// parsePublicKey parses a PEM encoded ed25519 or ECDSA public key
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse public key")
+	}
+
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// verifySignature reports whether the signature over the payload was made
+// with the private key of the supplied public key. ECDSA signatures are ASN.1
+// encoded, over a digest that matches the curve's size.
+func verifySignature(key crypto.PublicKey, payload, signature []byte) bool {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, signature)
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch k.Curve {
+		case elliptic.P384():
+			d := sha512.Sum384(payload)
+			digest = d[:]
+		case elliptic.P521():
+			d := sha512.Sum512(payload)
+			digest = d[:]
+		default:
+			d := sha256.Sum256(payload)
+			digest = d[:]
+		}
+		return ecdsa.VerifyASN1(k, digest, signature)
+	}
+	return false
+}
+
+// verifySignatures returns the approver records of the pending change that
+// are signed with a trusted key for this XR and hash, and haven't expired,
+// with a reason for each record that was rejected. Records of other changes
+// are kept, since they don't count anyway.
+func verifySignatures(records []approverRecord, keys map[string]crypto.PublicKey, signers map[string]v1beta1.ApprovalSigner, uid, newHash, currentHash, pendingHash string, now time.Time) ([]approverRecord, []string) {
+	var verified []approverRecord
+	var rejected []string
+	for _, r := range records {
+		if !matchesHash(r.Hash, newHash, currentHash, pendingHash) {
+			verified = append(verified, r)
+			continue
+		}
+
+		if reason := checkSignature(r, keys, signers, uid, newHash, now); reason != "" {
+			rejected = append(rejected, reason)
+			continue
+		}
+		verified = append(verified, r)
+	}
+	return verified, rejected
+}
+
+// checkSignature returns why the record's signature doesn't approve the
+// pending change, or an empty string if it does. The signature must cover the
+// full pending hash, so it can't be reused for another change, and the
+// approver's name and group, so it can't be reused by another approver. The
+// key must be bound to the approver and group the record names, so a key
+// can't sign for anyone else.
+func checkSignature(r approverRecord, keys map[string]crypto.PublicKey, signers map[string]v1beta1.ApprovalSigner, uid, newHash string, now time.Time) string {
+	if r.Signature == "" {
+		return fmt.Sprintf("approval by %s is not signed", r.Name)
+	}
+
+	expires, err := time.Parse(time.RFC3339, r.Expires)
+	if err != nil {
+		return fmt.Sprintf("approval by %s has no valid expiry", r.Name)
+	}
+	if now.After(expires) {
+		return fmt.Sprintf("approval by %s expired at %s", r.Name, r.Expires)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil {
+		return fmt.Sprintf("signature of the approval by %s is not base64 encoded", r.Name)
+	}
+
+	var ids []string
+	if r.KeyID != "" {
+		if _, ok := keys[r.KeyID]; !ok {
+			return fmt.Sprintf("approval by %s is signed with unknown key %s", r.Name, r.KeyID)
+		}
+		signer, ok := signers[r.KeyID]
+		if !ok {
+			return fmt.Sprintf("approval by %s is signed with key %s, which isn't bound to an approver", r.Name, r.KeyID)
+		}
+		if signer.Name != r.Name {
+			return fmt.Sprintf("approval by %s is signed with key %s, which belongs to %s", r.Name, r.KeyID, signer.Name)
+		}
+		if !maySignFor(signer, r.Group) {
+			return fmt.Sprintf("approval by %s names group %s, which key %s may not sign for", r.Name, r.Group, r.KeyID)
+		}
+		ids = []string{r.KeyID}
+	} else {
+		// Keys are tried in order, so the result doesn't depend on map order
+		for id, signer := range signers {
+			if _, ok := keys[id]; ok && signer.Name == r.Name && maySignFor(signer, r.Group) {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		if len(ids) == 0 {
+			if r.Group != "" {
+				return fmt.Sprintf("approval by %s names group %s, which none of their keys may sign for", r.Name, r.Group)
+			}
+			return fmt.Sprintf("no trusted key is bound to %s", r.Name)
+		}
+	}
+
+	payload := signedPayload(uid, newHash, r.Expires, r.Name, r.Group)
+	for _, id := range ids {
+		if verifySignature(keys[id], payload, signature) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("signature of the approval by %s is invalid for this XR, pending hash, approver and group", r.Name)
+}
+
+// maySignFor reports whether the signer's key may sign records of the group.
+// Records without a group don't approve for any group, so any key of the
+// approver may sign them.
+func maySignFor(s v1beta1.ApprovalSigner, group string) bool {
+	return group == "" || slices.Contains(s.Groups, group)
+}
+
+// approvalSigners returns the signers of the gate, keyed by their key's ID
+func approvalSigners(s *v1beta1.ApprovalSignatures) map[string]v1beta1.ApprovalSigner {
+	signers := make(map[string]v1beta1.ApprovalSigner, len(s.Signers))
+	for _, signer := range s.Signers {
+		signers[signer.KeyID] = signer
+	}
+	return signers
+}
+
+// getSignatureKeys reads the public keys trusted to sign approvals, keyed by
+// their ID
+func (f *Function) getSignatureKeys(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse) (map[string]crypto.PublicKey, error) {
+	raw := make(map[string][]byte)
+	if name := g.ApprovalSignatures.CredentialsName; name != "" {
+		creds, err := request.GetCredentials(req, name)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot get approval signature credentials"))
+			return nil, err
+		}
+		for id, data := range creds.Data {
+			raw[id] = data
+		}
+	} else {
+		entries, err := os.ReadDir(g.ApprovalSignatures.Directory)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot read approval signature key directory"))
+			return nil, err
+		}
+		for _, e := range entries {
+			// Mounted secrets and config maps keep their data in hidden
+			// directories, linked to from the visible files
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(g.ApprovalSignatures.Directory, e.Name()))
+			if err != nil {
+				response.Fatal(rsp, errors.Wrapf(err, "cannot read approval signature key %s", e.Name()))
+				return nil, err
+			}
+			raw[e.Name()] = data
+		}
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(raw))
+	for id, data := range raw {
+		key, err := parsePublicKey(data)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrapf(err, "invalid approval signature key %s", id))
+			return nil, err
+		}
+		keys[id] = key
+	}
+
+	if len(keys) == 0 {
+		response.Fatal(rsp, errors.New("no keys are trusted to sign approvals"))
+		return nil, errors.New("no approval signature keys")
+	}
+	return keys, nil
+}
+
+// validateApprovalSignatures checks that exactly one source of keys is set,
+// and that each key is bound to a single approver
+func validateApprovalSignatures(s *v1beta1.ApprovalSignatures) error {
+	if (s.CredentialsName == "") == (s.Directory == "") {
+		return errors.New("approvalSignatures must set exactly one of credentialsName and directory")
+	}
+	if len(s.Signers) == 0 {
+		return errors.New("approvalSignatures must bind at least one key to an approver in signers")
+	}
+	seen := make(map[string]bool, len(s.Signers))
+	for i, signer := range s.Signers {
+		if signer.KeyID == "" || signer.Name == "" {
+			return errors.Errorf("approvalSignatures.signers[%d] must set keyId and name", i)
+		}
+		if seen[signer.KeyID] {
+			return errors.Errorf("approvalSignatures.signers binds key %s more than once", signer.KeyID)
+		}
+		seen[signer.KeyID] = true
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+)
+
+// encodePublicKey returns the PEM encoding of a public key
+func encodePublicKey(t *testing.T, key crypto.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal public key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestParsePublicKey(t *testing.T) {
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	cases := map[string]struct {
+		data    []byte
+		wantErr bool
+	}{
+		"Ed25519": {data: encodePublicKey(t, edKey)},
+		"ECDSA":   {data: encodePublicKey(t, &ecKey.PublicKey)},
+		"RSA":     {data: encodePublicKey(t, &rsaKey.PublicKey), wantErr: true},
+		"NotPEM":  {data: []byte("not a key"), wantErr: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parsePublicKey(tc.data); (err != nil) != tc.wantErr {
+				t.Errorf("parsePublicKey(...): want error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckSignature(t *testing.T) {
+	const (
+		uid  = "5f8d2c1e-0000-4000-8000-000000000001"
+		hash = "sha256:v1:1111111111111111"
+	)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	expires := "2026-10-17T12:00:00Z"
+
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	ecPrivate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys := map[string]crypto.PublicKey{
+		"security": edPublic,
+		"platform": &ecPrivate.PublicKey,
+		"retired":  edPublic,
+	}
+	signers := map[string]v1beta1.ApprovalSigner{
+		"security": {KeyID: "security", Name: "alice", Groups: []string{"security"}},
+		"platform": {KeyID: "platform", Name: "bob"},
+	}
+
+	signEd := func(uid, hash, expires, name, group string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(edPrivate, signedPayload(uid, hash, expires, name, group)))
+	}
+	signEC := func(uid, hash, expires, name, group string) string {
+		digest := sha256.Sum256(signedPayload(uid, hash, expires, name, group))
+		sig, err := ecdsa.SignASN1(rand.Reader, ecPrivate, digest[:])
+		if err != nil {
+			t.Fatalf("cannot sign: %v", err)
+		}
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+
+	const invalid = "signature of the approval by alice is invalid for this XR, pending hash, approver and group"
+
+	cases := map[string]struct {
+		record approverRecord
+		want   string
+	}{
+		"Ed25519": {
+			record: approverRecord{Name: "alice", Group: "security", Hash: hash, KeyID: "security", Expires: expires, Signature: signEd(uid, hash, expires, "alice", "security")},
+		},
+		"ECDSA": {
+			record: approverRecord{Name: "bob", Hash: hash, KeyID: "platform", Expires: expires, Signature: signEC(uid, hash, expires, "bob", "")},
+		},
+		"AnyKeyOfApprover": {
+			record: approverRecord{Name: "alice", Group: "security", Hash: hash, Expires: expires, Signature: signEd(uid, hash, expires, "alice", "security")},
+		},
+		"NotSigned": {
+			record: approverRecord{Name: "alice", Hash: hash},
+			want:   "approval by alice is not signed",
+		},
+		"Expired": {
+			record: approverRecord{Name: "alice", Hash: hash, Expires: "2026-10-16T11:00:00Z", Signature: signEd(uid, hash, "2026-10-16T11:00:00Z", "alice", "")},
+			want:   "approval by alice expired at 2026-10-16T11:00:00Z",
+		},
+		"ExpiryChanged": {
+			record: approverRecord{Name: "alice", Hash: hash, Expires: "2027-10-16T12:00:00Z", Signature: signEd(uid, hash, expires, "alice", "")},
+			want:   invalid,
+		},
+		"OtherXR": {
+			record: approverRecord{Name: "alice", Hash: hash, Expires: expires, Signature: signEd("another-uid", hash, expires, "alice", "")},
+			want:   invalid,
+		},
+		"OtherHash": {
+			record: approverRecord{Name: "alice", Hash: hash, Expires: expires, Signature: signEd(uid, "sha256:v1:2222222222222222", expires, "alice", "")},
+			want:   invalid,
+		},
+		"OtherApprover": {
+			record: approverRecord{Name: "alice", Hash: hash, Expires: expires, Signature: signEd(uid, hash, expires, "mallory", "")},
+			want:   invalid,
+		},
+		"OtherGroup": {
+			record: approverRecord{Name: "alice", Group: "security", Hash: hash, Expires: expires, Signature: signEd(uid, hash, expires, "alice", "platform")},
+			want:   invalid,
+		},
+		"KeyOfOtherApprover": {
+			record: approverRecord{Name: "alice", Hash: hash, KeyID: "platform", Expires: expires, Signature: signEd(uid, hash, expires, "alice", "")},
+			want:   "approval by alice is signed with key platform, which belongs to bob",
+		},
+		"SignedAsOtherApprover": {
+			record: approverRecord{Name: "bob", Hash: hash, KeyID: "security", Expires: expires, Signature: signEd(uid, hash, expires, "bob", "")},
+			want:   "approval by bob is signed with key security, which belongs to alice",
+		},
+		"GroupNotBoundToKey": {
+			record: approverRecord{Name: "alice", Group: "platform", Hash: hash, KeyID: "security", Expires: expires, Signature: signEd(uid, hash, expires, "alice", "platform")},
+			want:   "approval by alice names group platform, which key security may not sign for",
+		},
+		"GroupNotBoundToAnyKey": {
+			record: approverRecord{Name: "alice", Group: "platform", Hash: hash, Expires: expires, Signature: signEd(uid, hash, expires, "alice", "platform")},
+			want:   "approval by alice names group platform, which none of their keys may sign for",
+		},
+		"ApproverWithoutKey": {
+			record: approverRecord{Name: "mallory", Hash: hash, Expires: expires, Signature: signEd(uid, hash, expires, "mallory", "")},
+			want:   "no trusted key is bound to mallory",
+		},
+		"UnboundKey": {
+			record: approverRecord{Name: "alice", Hash: hash, KeyID: "retired", Expires: expires, Signature: signEd(uid, hash, expires, "alice", "")},
+			want:   "approval by alice is signed with key retired, which isn't bound to an approver",
+		},
+		"UnknownKey": {
+			record: approverRecord{Name: "alice", Hash: hash, KeyID: "legacy", Expires: expires, Signature: signEd(uid, hash, expires, "alice", "")},
+			want:   "approval by alice is signed with unknown key legacy",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := checkSignature(tc.record, keys, signers, uid, hash, now); got != tc.want {
+				t.Errorf("checkSignature(...): want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestVerifySignaturesDuplicatedSignature(t *testing.T) {
+	const (
+		uid  = "5f8d2c1e-0000-4000-8000-000000000001"
+		hash = "sha256:v1:1111111111111111"
+	)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	expires := "2026-10-17T12:00:00Z"
+
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	keys := map[string]crypto.PublicKey{"alice": public}
+	signers := map[string]v1beta1.ApprovalSigner{"alice": {KeyID: "alice", Name: "alice", Groups: []string{"security", "platform"}}}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, signedPayload(uid, hash, expires, "alice", "security")))
+
+	// Copying alice's signature into records of other approvers doesn't
+	// verify, since the signature covers the approver and group
+	records := []approverRecord{
+		{Name: "alice", Group: "security", Hash: hash, Expires: expires, Signature: signature},
+		{Name: "mallory", Group: "security", Hash: hash, Expires: expires, Signature: signature},
+		{Name: "alice", Group: "platform", Hash: hash, Expires: expires, Signature: signature},
+	}
+
+	verified, rejected := verifySignatures(records, keys, signers, uid, hash, "", hash, now)
+	if len(verified) != 1 || verified[0].Name != "alice" || verified[0].Group != "security" {
+		t.Errorf("verifySignatures(...): want only alice's record verified, got %+v", verified)
+	}
+	if len(rejected) != 2 {
+		t.Errorf("verifySignatures(...): want 2 rejected records, got %v", rejected)
+	}
+
+	p := evaluateQuorum(verified, &v1beta1.Quorum{Approvals: 2}, hash, "", hash)
+	if p.Met {
+		t.Errorf("evaluateQuorum(...): expected a duplicated signature not to meet a quorum of 2: %s", p.Progress)
+	}
+}
+
+func TestVerifySignaturesKeyBoundToApprover(t *testing.T) {
+	const (
+		uid  = "5f8d2c1e-0000-4000-8000-000000000001"
+		hash = "sha256:v1:1111111111111111"
+	)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	expires := "2026-10-17T12:00:00Z"
+
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	keys := map[string]crypto.PublicKey{"security": public}
+	signers := map[string]v1beta1.ApprovalSigner{"security": {KeyID: "security", Name: "alice"}}
+	sign := func(name, group string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(private, signedPayload(uid, hash, expires, name, group)))
+	}
+
+	// The holder of alice's key can't approve as bob, nor for a group the
+	// key isn't bound to
+	records := []approverRecord{
+		{Name: "alice", Hash: hash, KeyID: "security", Expires: expires, Signature: sign("alice", "")},
+		{Name: "bob", Hash: hash, KeyID: "security", Expires: expires, Signature: sign("bob", "")},
+		{Name: "alice", Group: "security", Hash: hash, KeyID: "security", Expires: expires, Signature: sign("alice", "security")},
+	}
+
+	verified, rejected := verifySignatures(records, keys, signers, uid, hash, "", hash, now)
+	want := []string{
+		"approval by bob is signed with key security, which belongs to alice",
+		"approval by alice names group security, which key security may not sign for",
+	}
+	if len(verified) != 1 || verified[0].Name != "alice" || !slices.Equal(rejected, want) {
+		t.Errorf("verifySignatures(...): want only alice's record without a group verified and %q rejected, got verified %+v, rejected %v", want, verified, rejected)
+	}
+
+	p := evaluateQuorum(verified, &v1beta1.Quorum{Approvals: 2}, hash, "", hash)
+	if p.Met {
+		t.Errorf("evaluateQuorum(...): expected a single key not to meet a quorum of 2: %s", p.Progress)
+	}
+}
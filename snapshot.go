@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+const (
+	// maxDiffChanges is the most changes listed in a condition message
+	maxDiffChanges = 20
+
+	// maxDiffValueLength is the longest value shown in a condition message
+	maxDiffValueLength = 80
+)
+
+// snapshot is the watched data at the last approval
+type snapshot struct {
+	// Hash is the hash the snapshot was taken at
+	Hash string `json:"hash"`
+
+	// Fields are the values of the watched fields, keyed by concrete path
+	Fields map[string]interface{} `json:"fields"`
+
+	// Baseline are the values of fields that changed within a tolerance since
+	// the last manual approval, as they were at that approval. They are keyed
+	// by concrete path.
+	Baseline map[string]interface{} `json:"baseline,omitempty"`
+
+	// MAC is the hex encoded HMAC that seals the snapshot to its hash, if the
+	// gate has a hash key
+	MAC string `json:"mac,omitempty"`
+}
+
+// newSnapshot returns a snapshot of the supplied watched fields. Missing
+// fields are left out.
+func newSnapshot(hash string, fields []watchedField) *snapshot {
+	s := &snapshot{Hash: hash, Fields: make(map[string]interface{})}
+	for _, field := range fields {
+		if field.Missing {
+			continue
+		}
+		for _, m := range field.matches() {
+			s.Fields[m.Path] = m.Value
+		}
+	}
+	return s
+}
+
+// encodeSnapshot returns the snapshot as gzipped JSON, base64 encoded so it
+// can be stored as a string
+func encodeSnapshot(s *snapshot) (string, error) {
+	encoded, err := encodeCompressed(s)
+	return encoded, errors.Wrap(err, "cannot encode snapshot")
+}
+
+// decodeSnapshot decodes a snapshot encoded by encodeSnapshot
+func decodeSnapshot(encoded string) (*snapshot, error) {
+	s := &snapshot{}
+	if err := decodeCompressed(encoded, s); err != nil {
+		return nil, errors.Wrap(err, "cannot decode snapshot")
+	}
+	return s, nil
+}
+
+// sealSnapshot seals the snapshot to its hash with an HMAC keyed with the
+// supplied key
+func sealSnapshot(s *snapshot, key []byte) error {
+	mac, err := macSnapshot(s, key)
+	if err != nil {
+		return errors.Wrap(err, "cannot seal snapshot")
+	}
+	s.MAC = mac
+	return nil
+}
+
+// verifySnapshot returns true if the snapshot was sealed to its hash with the
+// supplied key. A snapshot that isn't sealed can be forged by anyone
+// able to write the status, to make a change look smaller than it is.
+func verifySnapshot(s *snapshot, key []byte) bool {
+	if s.MAC == "" {
+		return false
+	}
+
+	mac, err := macSnapshot(s, key)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(s.MAC))
+}
+
+// macSnapshot returns the hex encoded HMAC of the snapshot without its MAC
+func macSnapshot(s *snapshot, key []byte) (string, error) {
+	unsealed := *s
+	unsealed.MAC = ""
+	return macBoundToHash(unsealed, s.Hash, key)
+}
+
+// encodeCompressed returns the value as gzipped JSON, base64 encoded so it can
+// be stored as a string
+func encodeCompressed(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot marshal to JSON")
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return "", errors.Wrap(err, "cannot compress")
+	}
+	if err := zw.Close(); err != nil {
+		return "", errors.Wrap(err, "cannot compress")
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decodeCompressed decodes a value encoded by encodeCompressed into the
+// supplied value
+func decodeCompressed(encoded string, into interface{}) error {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return errors.Wrap(err, "cannot decode base64")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "cannot decompress")
+	}
+	defer zr.Close() //nolint:errcheck // Nothing to do if closing a reader fails
+
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return errors.Wrap(err, "cannot decompress")
+	}
+
+	return errors.Wrap(json.Unmarshal(raw, into), "cannot unmarshal JSON")
+}
+
+// Kinds of change between the approved and the pending data.
+const (
+	changeAdded    = "added"
+	changeRemoved  = "removed"
+	changeModified = "changed"
+)
+
+// change is a single difference between the approved and the pending data
+type change struct {
+	// Path is the concrete path of the value that changed
+	Path string
+
+	// Kind is the kind of change: added, removed or changed
+	Kind string
+
+	// Old is the approved value. It is nil if the value was added.
+	Old interface{}
+
+	// New is the pending value. It is nil if the value was removed.
+	New interface{}
+
+	// Class is the class of the change: Additive, Modifying or Destructive.
+	// It is set by classifyChanges.
+	Class string
+
+	// Tolerated is true if the change is within a tolerance. It is set by
+	// applyTolerances.
+	Tolerated bool
+}
+
+// diffSnapshots returns the differences between two snapshots, ordered by
+// path. Maps are compared key by key and lists element by element, so that
+// each change is reported at the deepest path that changed.
+func diffSnapshots(approved, pending *snapshot) []change {
+	// Paths of list elements matched by a pattern are ordered by index, so
+	// that patches add and remove them in a valid order
+	paths := unionKeys(approved.Fields, pending.Fields)
+	SortPaths(paths)
+
+	var changes []change
+	for _, path := range paths {
+		segments, err := ParseNestedKey(path)
+		if err != nil {
+			continue
+		}
+
+		old, hadOld := approved.Fields[path]
+		now, hasNew := pending.Fields[path]
+		switch {
+		case !hadOld:
+			changes = append(changes, change{Path: path, Kind: changeAdded, New: now})
+		case !hasNew:
+			changes = append(changes, change{Path: path, Kind: changeRemoved, Old: old})
+		default:
+			diffValues(segments, old, now, &changes)
+		}
+	}
+	return changes
+}
+
+// diffValues appends the differences between two values at the supplied path
+func diffValues(path []PathSegment, old, now interface{}, changes *[]change) {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := now.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		for _, k := range unionKeys(oldMap, newMap) {
+			p := appendSegment(path, PathSegment{Type: PathSegmentField, Field: k})
+			o, hadOld := oldMap[k]
+			n, hasNew := newMap[k]
+			switch {
+			case !hadOld:
+				*changes = append(*changes, change{Path: FormatPath(p), Kind: changeAdded, New: n})
+			case !hasNew:
+				*changes = append(*changes, change{Path: FormatPath(p), Kind: changeRemoved, Old: o})
+			default:
+				diffValues(p, o, n, changes)
+			}
+		}
+		return
+	}
+
+	oldList, oldIsList := old.([]interface{})
+	newList, newIsList := now.([]interface{})
+	if oldIsList && newIsList {
+		for i := 0; i < len(oldList) || i < len(newList); i++ {
+			p := appendSegment(path, PathSegment{Type: PathSegmentIndex, Index: i})
+			switch {
+			case i >= len(oldList):
+				*changes = append(*changes, change{Path: FormatPath(p), Kind: changeAdded, New: newList[i]})
+			case i >= len(newList):
+				*changes = append(*changes, change{Path: FormatPath(p), Kind: changeRemoved, Old: oldList[i]})
+			default:
+				diffValues(p, oldList[i], newList[i], changes)
+			}
+		}
+		return
+	}
+
+	// Values are compared by their encoding, since the approved values were
+	// decoded from JSON and may have different Go types
+	if !sameJSON(old, now) {
+		*changes = append(*changes, change{Path: FormatPath(path), Kind: changeModified, Old: old, New: now})
+	}
+}
+
+// unionKeys returns the keys of both maps, sorted
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sameJSON returns true if both values have the same JSON encoding
+func sameJSON(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// describeChanges renders the changes for a condition message
+func describeChanges(changes []change) string {
+	var b strings.Builder
+	b.WriteString("Changes since the last approval:")
+	if len(changes) == 0 {
+		b.WriteString("\n- none")
+	}
+
+	for i, c := range changes {
+		if i == maxDiffChanges {
+			b.WriteString("\n- ... and " + strconv.Itoa(len(changes)-i) + " more")
+			break
+		}
+
+		switch c.Kind {
+		case changeAdded:
+			b.WriteString("\n- " + c.Path + " added: " + formatDiffValue(c.New))
+		case changeRemoved:
+			b.WriteString("\n- " + c.Path + " removed: " + formatDiffValue(c.Old))
+		default:
+			b.WriteString("\n- " + c.Path + " changed: " + formatDiffValue(c.Old) + " → " + formatDiffValue(c.New))
+		}
+		switch {
+		case c.Tolerated:
+			b.WriteString(" (" + strings.ToLower(c.Class) + ", within tolerance)")
+		case c.Class != "":
+			b.WriteString(" (" + strings.ToLower(c.Class) + ")")
+		}
+	}
+	return b.String()
+}
+
+// formatDiffValue renders a value as JSON, shortened if it is too long
+func formatDiffValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "?"
+	}
+
+	r := []rune(string(data))
+	if len(r) > maxDiffValueLength {
+		return string(r[:maxDiffValueLength-3]) + "..."
+	}
+	return string(r)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeSnapshot(t *testing.T) {
+	s := &snapshot{
+		Hash: "sha256:v1:abcdef",
+		Fields: map[string]interface{}{
+			"spec.resources": map[string]interface{}{"size": "large", "count": float64(3)},
+		},
+	}
+
+	encoded, err := encodeSnapshot(s)
+	if err != nil {
+		t.Fatalf("encodeSnapshot(...): unexpected error: %v", err)
+	}
+
+	got, err := decodeSnapshot(encoded)
+	if err != nil {
+		t.Fatalf("decodeSnapshot(...): unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("decodeSnapshot(encodeSnapshot(...)): want %v, got %v", s, got)
+	}
+
+	if _, err := decodeSnapshot("not a snapshot"); err == nil {
+		t.Error("decodeSnapshot(...): expected an error for an invalid snapshot but got none")
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	approved := &snapshot{Fields: map[string]interface{}{
+		"spec.resources": map[string]interface{}{
+			"size":  "large",
+			"count": float64(3),
+			"zones": []interface{}{"a", "b"},
+			"tags":  map[string]interface{}{"team": "a"},
+		},
+		"spec.networking": map[string]interface{}{"cidr": "10.0.0.0/16"},
+	}}
+	pending := &snapshot{Fields: map[string]interface{}{
+		"spec.resources": map[string]interface{}{
+			"size":         "small",
+			"count":        int64(3),
+			"zones":        []interface{}{"a"},
+			"tags":         map[string]interface{}{"team": "a"},
+			"example.com/": "new",
+		},
+		"spec.parameters": map[string]interface{}{"region": "us-east-1"},
+	}}
+
+	want := []change{
+		{Path: "spec.networking", Kind: changeRemoved, Old: map[string]interface{}{"cidr": "10.0.0.0/16"}},
+		{Path: "spec.parameters", Kind: changeAdded, New: map[string]interface{}{"region": "us-east-1"}},
+		{Path: `spec.resources["example.com/"]`, Kind: changeAdded, New: "new"},
+		{Path: "spec.resources.size", Kind: changeModified, Old: "large", New: "small"},
+		{Path: "spec.resources.zones[1]", Kind: changeRemoved, Old: "b"},
+	}
+
+	got := diffSnapshots(approved, pending)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffSnapshots(...):\nwant %v\ngot  %v", want, got)
+	}
+
+	message := describeChanges(got)
+	for _, line := range []string{
+		"- spec.networking removed: {\"cidr\":\"10.0.0.0/16\"}",
+		"- spec.parameters added: {\"region\":\"us-east-1\"}",
+		"- spec.resources.size changed: \"large\" → \"small\"",
+	} {
+		if !strings.Contains(message, line) {
+			t.Errorf("describeChanges(...): expected %q in %q", line, message)
+		}
+	}
+}
+
+func TestSealSnapshot(t *testing.T) {
+	s := &snapshot{
+		Hash:   "sha256:v1:e02c6d35c585a43c62dc2ae14a5385b8a86168b36be7a0d985c0c09afca4ffbe",
+		Fields: map[string]interface{}{"spec.resources": map[string]interface{}{"storage": "100Gi"}},
+	}
+	if err := sealSnapshot(s, []byte("secret")); err != nil {
+		t.Fatalf("sealSnapshot(...): unexpected error: %v", err)
+	}
+
+	// The seal must survive being stored and read back
+	encoded, err := encodeSnapshot(s)
+	if err != nil {
+		t.Fatalf("encodeSnapshot(...): unexpected error: %v", err)
+	}
+	decoded, err := decodeSnapshot(encoded)
+	if err != nil {
+		t.Fatalf("decodeSnapshot(...): unexpected error: %v", err)
+	}
+	if !verifySnapshot(decoded, []byte("secret")) {
+		t.Error("verifySnapshot(...): expected a sealed snapshot to be valid")
+	}
+
+	if verifySnapshot(decoded, []byte("another secret")) {
+		t.Error("verifySnapshot(...): expected a snapshot sealed with another key to be invalid")
+	}
+
+	forged := *decoded
+	forged.Fields = map[string]interface{}{"spec.resources": map[string]interface{}{"storage": "10Gi"}}
+	if verifySnapshot(&forged, []byte("secret")) {
+		t.Error("verifySnapshot(...): expected a snapshot with altered fields to be invalid")
+	}
+}
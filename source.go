@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// Sources an approval can be read from.
+const (
+	// approvalSourceStatus is a field of the XR's status
+	approvalSourceStatus = "status"
+
+	// approvalSourceAnnotation is an annotation of the XR
+	approvalSourceAnnotation = "annotation"
+
+	// approvalSourceSpec is a field of the XR's spec
+	approvalSourceSpec = "spec"
+
+	// approvalSourceObjects are separate objects labelled with the XR's UID
+	approvalSourceObjects = "objects"
+)
+
+// approvalSource returns where the approval field is read from. Fields that
+// aren't annotations or in spec are relative to status.
+func approvalSource(field string) string {
+	segments, err := ParseNestedKey(field)
+	if err != nil || len(segments) < 2 {
+		return approvalSourceStatus
+	}
+
+	switch {
+	case len(segments) > 2 && segments[0].Field == "metadata" && segments[1].Field == "annotations":
+		return approvalSourceAnnotation
+	case segments[0].Field == "spec":
+		return approvalSourceSpec
+	}
+	return approvalSourceStatus
+}
+
+// gateApprovalSource returns where the gate reads approvals from
+func gateApprovalSource(g *v1beta1.Gate) string {
+	if g.ApprovalObjects != nil {
+		return approvalSourceObjects
+	}
+	return approvalSource(*g.ApprovalField)
+}
+
+// describeApprovalSource describes where the gate read an approval from, e.g.
+// "annotation (metadata.annotations[approved])"
+func describeApprovalSource(g *v1beta1.Gate) string {
+	if g.ApprovalObjects != nil {
+		apiVersion, kind := approvalObjectsKind(g.ApprovalObjects)
+		return approvalSourceObjects + " (" + apiVersion + " " + kind + ")"
+	}
+	return approvalSource(*g.ApprovalField) + " (" + *g.ApprovalField + ")"
+}
+
+// approvalValue returns the approval held by a field outside status.
+// Annotations can only hold strings, so "true" and "false" are booleans.
+func approvalValue(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return s
+}
+
+// getApprovalValue retrieves the value of the gate's approval field from its
+// source. The returned bool reports whether the field exists at all.
+func (f *Function) getApprovalValue(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse) (interface{}, bool, error) {
+	if approvalSource(*g.ApprovalField) == approvalSourceStatus {
+		xrStatus, _, err := f.getXRAndStatus(req)
+		if err != nil {
+			response.Fatal(rsp, err)
+			return nil, false, err
+		}
+
+		// Resolve the field relative to status
+		approvalField := trimStatusPrefix(*g.ApprovalField)
+
+		value, exists, err := GetNestedValue(xrStatus, approvalField)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrapf(err, "error accessing approval field %s", approvalField))
+			return nil, false, err
+		}
+		return value, exists, nil
+	}
+
+	// Annotations and spec fields are read from the XR as it was observed,
+	// since the function doesn't change them
+	oxr, err := request.GetObservedCompositeResource(req)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot get observed composite resource"))
+		return nil, false, err
+	}
+
+	value, exists, err := GetNestedValue(oxr.Resource.Object, *g.ApprovalField)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrapf(err, "error accessing approval field %s", *g.ApprovalField))
+		return nil, false, err
+	}
+	return approvalValue(value), exists, nil
+}
+
+// checkConsumedApproval returns the hash an approval of true outside status
+// was already used for, if it's still set. Once the approval is removed or
+// set to false the record is cleared, so that setting it to true approves
+// the next change.
+func (f *Function) checkConsumedApproval(req *fnv1.RunFunctionRequest, g *v1beta1.Gate, rsp *fnv1.RunFunctionResponse, value interface{}) (string, error) {
+	consumed, _, err := f.getStatusString(req, *g.ConsumedApprovalField, rsp)
+	if err != nil || consumed == "" {
+		return "", err
+	}
+
+	if v, ok := value.(bool); ok && v {
+		return consumed, nil
+	}
+
+	return "", f.setStatusFields(rsp, map[string]interface{}{
+		*g.ConsumedApprovalField: "",
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestApprovalSource(t *testing.T) {
+	cases := map[string]struct {
+		field string
+		want  string
+	}{
+		"Status":         {field: "status.approved", want: approvalSourceStatus},
+		"RelativeStatus": {field: "approved", want: approvalSourceStatus},
+		"NestedStatus":   {field: "status.gates.security.approved", want: approvalSourceStatus},
+		"Annotation":     {field: `metadata.annotations["approve.fn.crossplane.io/approved"]`, want: approvalSourceAnnotation},
+		"Annotations":    {field: "metadata.annotations", want: approvalSourceStatus},
+		"Spec":           {field: "spec.approval", want: approvalSourceSpec},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := approvalSource(tc.field); got != tc.want {
+				t.Errorf("approvalSource(%q): want %q, got %q", tc.field, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestApprovalValue(t *testing.T) {
+	cases := map[string]struct {
+		value interface{}
+		want  interface{}
+	}{
+		"True":    {value: "true", want: true},
+		"False":   {value: " False ", want: false},
+		"Hash":    {value: "a07bdeee", want: "a07bdeee"},
+		"Boolean": {value: true, want: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := approvalValue(tc.value); got != tc.want {
+				t.Errorf("approvalValue(%v): want %v, got %v", tc.value, tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// toleranceLimit is a parsed MaxIncrease or MaxDecrease
+type toleranceLimit struct {
+	// Amount is the absolute amount, if the limit isn't a percentage
+	Amount resource.Quantity
+
+	// Percent is the percentage of the approved value, if the limit is one
+	Percent float64
+
+	// IsPercent is true if the limit is a percentage
+	IsPercent bool
+}
+
+// parseToleranceLimit parses an absolute amount, such as "2" or "10Gi", or a
+// percentage, such as "20%"
+func parseToleranceLimit(s string) (toleranceLimit, error) {
+	s = strings.TrimSpace(s)
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || percent < 0 {
+			return toleranceLimit{}, errors.Errorf("invalid percentage %q", s)
+		}
+		return toleranceLimit{Percent: percent, IsPercent: true}, nil
+	}
+
+	q, err := resource.ParseQuantity(s)
+	if err != nil || q.Sign() < 0 {
+		return toleranceLimit{}, errors.Errorf("invalid amount %q", s)
+	}
+	return toleranceLimit{Amount: q}, nil
+}
+
+// allows returns true if a change of delta from old is within the limit. The
+// delta is never negative.
+func (l toleranceLimit) allows(old, delta resource.Quantity) bool {
+	if !l.IsPercent {
+		return delta.Cmp(l.Amount) <= 0
+	}
+
+	base := old.AsApproximateFloat64()
+	if base < 0 {
+		base = -base
+	}
+	if base == 0 {
+		// Any change of zero is an infinite percentage
+		return delta.IsZero()
+	}
+	return delta.AsApproximateFloat64()/base*100 <= l.Percent
+}
+
+// validateTolerance checks that a tolerance's path and limits can be parsed
+func validateTolerance(t v1beta1.Tolerance) error {
+	if _, err := ParseNestedKey(t.Path); err != nil {
+		return errors.Wrapf(err, "invalid tolerance path %q", t.Path)
+	}
+	for _, limit := range []*string{t.MaxIncrease, t.MaxDecrease} {
+		if limit == nil {
+			continue
+		}
+		if _, err := parseToleranceLimit(*limit); err != nil {
+			return errors.Wrapf(err, "invalid tolerance for %s", t.Path)
+		}
+	}
+	return nil
+}
+
+// applyTolerances marks the changes that are within a tolerance. Tolerance
+// paths are expanded against the supplied data, and a change is only
+// tolerated if a tolerance selects exactly the value that changed. Values in
+// the baseline are measured from their baseline value rather than from the
+// approved one.
+func applyTolerances(changes []change, tolerances []v1beta1.Tolerance, data, baseline map[string]interface{}) error {
+	for _, t := range tolerances {
+		matches, err := ExpandPath(data, t.Path)
+		if err != nil {
+			return errors.Wrapf(err, "cannot expand tolerance path %s", t.Path)
+		}
+
+		for _, m := range matches {
+			for i := range changes {
+				c := &changes[i]
+				if c.Path != m.Path || c.Tolerated {
+					continue
+				}
+				measured := *c
+				if old, ok := baseline[c.Path]; ok {
+					measured.Old = old
+				}
+				c.Tolerated = withinTolerance(measured, t)
+			}
+		}
+	}
+	return nil
+}
+
+// withinTolerance returns true if a changed number or quantity moved no further
+// than the tolerance allows
+func withinTolerance(c change, t v1beta1.Tolerance) bool {
+	if c.Kind != changeModified {
+		return false
+	}
+
+	old, ok := toQuantity(c.Old)
+	if !ok {
+		return false
+	}
+	now, ok := toQuantity(c.New)
+	if !ok {
+		return false
+	}
+
+	delta := now.DeepCopy()
+	delta.Sub(old)
+
+	limit := t.MaxIncrease
+	if delta.Sign() < 0 {
+		limit = t.MaxDecrease
+		delta.Neg()
+	}
+	if limit == nil {
+		return false
+	}
+
+	l, err := parseToleranceLimit(*limit)
+	if err != nil {
+		return false
+	}
+	return l.allows(old, delta)
+}
+
+// toleranceBaseline returns the baseline to record when the changes are
+// approved without an approval. Values that changed within a tolerance keep
+// the value they had at the last manual approval, so that repeated small
+// changes can't add up to a large one.
+func toleranceBaseline(approved *snapshot, changes []change) map[string]interface{} {
+	if approved == nil {
+		return nil
+	}
+
+	baseline := make(map[string]interface{}, len(approved.Baseline))
+	for path, v := range approved.Baseline {
+		baseline[path] = v
+	}
+	for _, c := range changes {
+		if _, ok := baseline[c.Path]; c.Tolerated && !ok {
+			baseline[c.Path] = c.Old
+		}
+	}
+
+	if len(baseline) == 0 {
+		return nil
+	}
+	return baseline
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/upbound/function-approve/input/v1beta1"
+)
+
+func TestWithinTolerance(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+
+	cases := map[string]struct {
+		c    change
+		t    v1beta1.Tolerance
+		want bool
+	}{
+		"AbsoluteIncrease": {
+			c:    change{Kind: changeModified, Old: float64(3), New: float64(5)},
+			t:    v1beta1.Tolerance{MaxIncrease: ptr("2")},
+			want: true,
+		},
+		"AbsoluteIncreaseTooLarge": {
+			c: change{Kind: changeModified, Old: float64(3), New: float64(6)},
+			t: v1beta1.Tolerance{MaxIncrease: ptr("2")},
+		},
+		"DecreaseNotTolerated": {
+			c: change{Kind: changeModified, Old: float64(3), New: float64(2)},
+			t: v1beta1.Tolerance{MaxIncrease: ptr("2")},
+		},
+		"PercentageIncrease": {
+			c:    change{Kind: changeModified, Old: "100Gi", New: "120Gi"},
+			t:    v1beta1.Tolerance{MaxIncrease: ptr("20%")},
+			want: true,
+		},
+		"PercentageIncreaseTooLarge": {
+			c: change{Kind: changeModified, Old: "100Gi", New: "121Gi"},
+			t: v1beta1.Tolerance{MaxIncrease: ptr("20%")},
+		},
+		"QuantityDecrease": {
+			c:    change{Kind: changeModified, Old: "1", New: "500m"},
+			t:    v1beta1.Tolerance{MaxDecrease: ptr("500m")},
+			want: true,
+		},
+		"MixedUnits": {
+			c:    change{Kind: changeModified, Old: "1Gi", New: "1100Mi"},
+			t:    v1beta1.Tolerance{MaxIncrease: ptr("100Mi")},
+			want: true,
+		},
+		"IncreaseFromZero": {
+			c: change{Kind: changeModified, Old: float64(0), New: float64(1)},
+			t: v1beta1.Tolerance{MaxIncrease: ptr("50%")},
+		},
+		"NotANumber": {
+			c: change{Kind: changeModified, Old: "small", New: "large"},
+			t: v1beta1.Tolerance{MaxIncrease: ptr("100%")},
+		},
+		"Added": {
+			c: change{Kind: changeAdded, New: float64(1)},
+			t: v1beta1.Tolerance{MaxIncrease: ptr("100%")},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := withinTolerance(tc.c, tc.t); got != tc.want {
+				t.Errorf("withinTolerance(...): want %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestApplyTolerances(t *testing.T) {
+	maxIncrease := "1"
+	data := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"nodePools": []interface{}{
+				map[string]interface{}{"name": "default", "count": float64(4)},
+				map[string]interface{}{"name": "gpu", "count": float64(3)},
+				map[string]interface{}{"name": "spot", "count": float64(5)},
+			},
+			"replicas": float64(3),
+		},
+	}
+	changes := []change{
+		{Path: "spec.nodePools[0].count", Kind: changeModified, Old: float64(3), New: float64(4)},
+		{Path: "spec.nodePools[1].count", Kind: changeModified, Old: float64(1), New: float64(3)},
+		{Path: "spec.replicas", Kind: changeModified, Old: float64(2), New: float64(3)},
+		{Path: "spec.nodePools[2].count", Kind: changeModified, Old: float64(4), New: float64(5)},
+	}
+	tolerances := []v1beta1.Tolerance{{Path: "spec.nodePools[*].count", MaxIncrease: &maxIncrease}}
+
+	// The spot pool already grew within the tolerance since the last manual
+	// approval, so it's measured from where it was then
+	baseline := map[string]interface{}{"spec.nodePools[2].count": float64(3)}
+
+	if err := applyTolerances(changes, tolerances, data, baseline); err != nil {
+		t.Fatalf("applyTolerances(...): unexpected error: %v", err)
+	}
+
+	want := []bool{true, false, false, false}
+	for i, c := range changes {
+		if c.Tolerated != want[i] {
+			t.Errorf("applyTolerances(...): %s: want tolerated %t, got %t", c.Path, want[i], c.Tolerated)
+		}
+	}
+}
+
+func TestToleranceBaseline(t *testing.T) {
+	approved := &snapshot{Baseline: map[string]interface{}{"spec.storage": "100Gi"}}
+	changes := []change{
+		{Path: "spec.storage", Kind: changeModified, Old: "110Gi", New: "120Gi", Tolerated: true},
+		{Path: "spec.replicas", Kind: changeModified, Old: float64(2), New: float64(3), Tolerated: true},
+		{Path: "spec.zones[1]", Kind: changeAdded, New: "b"},
+	}
+
+	want := map[string]interface{}{"spec.storage": "100Gi", "spec.replicas": float64(2)}
+	if got := toleranceBaseline(approved, changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("toleranceBaseline(...): want %v, got %v", want, got)
+	}
+
+	if got := toleranceBaseline(&snapshot{}, changes[2:]); got != nil {
+		t.Errorf("toleranceBaseline(...): want no baseline without tolerated changes, got %v", got)
+	}
+}